@@ -0,0 +1,159 @@
+package gstats
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type breakdownKey struct{}
+
+// Breakdown times a request and the segments nested inside it, handler →
+// service → db, and when the request ends sends every segment's time and
+// its self time, the part not spent in its own segments, as histogram
+// samples in milliseconds. Segments are named by their path,
+// "checkout.service.db" and "checkout.service.db.self"; a segment entered
+// several times in one request is sent once, with its times added up.
+// > ctx, breakdown := gstats.WithBreakdown(r.Context(), stats, "checkout")
+// > defer breakdown.End()
+// > ...
+// > ctx, end := gstats.Segment(ctx, "db") // anywhere below
+// > defer end()
+type Breakdown struct {
+	// when set, requests slower than SlowerThan are logged to Logger with
+	// a waterfall of their segments
+	Logger     *slog.Logger
+	SlowerThan time.Duration
+
+	stats Statser
+	clock Clock
+	mu    sync.Mutex
+	root  *segment
+	ended bool
+}
+
+type segment struct {
+	name     string
+	path     string
+	start    time.Time
+	duration time.Duration
+	ended    bool
+	children []*segment
+	// the segment's Breakdown, so Segment can find it from ctx
+	breakdown *Breakdown
+}
+
+// WithBreakdown starts timing a request, a nil Statser means Default()
+func WithBreakdown(ctx context.Context, s Statser, name string) (context.Context, *Breakdown) {
+	s = statserOrDefault(s)
+	b := &Breakdown{stats: s, clock: clockOf(s)}
+	b.root = &segment{name: name, path: name, start: b.clock.Now(), breakdown: b}
+	return context.WithValue(ctx, breakdownKey{}, b.root), b
+}
+
+// Segment starts timing part of the request ctx belongs to, nested in the
+// segment ctx was made for. Outside a Breakdown it times nothing.
+func Segment(ctx context.Context, name string) (context.Context, func()) {
+	parent, ok := ctx.Value(breakdownKey{}).(*segment)
+	if !ok {
+		return ctx, func() {}
+	}
+	b := parent.breakdown
+	child := &segment{name: name, path: parent.path + "." + name, start: b.clock.Now(), breakdown: b}
+	b.mu.Lock()
+	parent.children = append(parent.children, child)
+	b.mu.Unlock()
+	return context.WithValue(ctx, breakdownKey{}, child), func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		child.end(b.clock.Now())
+	}
+}
+
+// callers must hold b.mu
+func (seg *segment) end(now time.Time) {
+	if !seg.ended {
+		seg.duration = now.Sub(seg.start)
+		seg.ended = true
+	}
+}
+
+// the time not spent in child segments, children that ran in parallel can
+// add up to more than their parent
+func (seg *segment) self() time.Duration {
+	self := seg.duration
+	for _, child := range seg.children {
+		self -= child.duration
+	}
+	if self < 0 {
+		return 0
+	}
+	return self
+}
+
+// End ends the request and sends the breakdown, only the first call does
+// anything. Segments that have not ended yet end with the request.
+func (b *Breakdown) End() {
+	b.mu.Lock()
+	if b.ended {
+		b.mu.Unlock()
+		return
+	}
+	b.ended = true
+	now := b.clock.Now()
+	totals := map[string]time.Duration{}
+	selves := map[string]time.Duration{}
+	var walk func(seg *segment)
+	walk = func(seg *segment) {
+		seg.end(now)
+		for _, child := range seg.children {
+			walk(child)
+		}
+		totals[seg.path] += seg.duration
+		selves[seg.path] += seg.self()
+	}
+	walk(b.root)
+	waterfall := ""
+	if b.Logger != nil && b.root.duration >= b.SlowerThan {
+		waterfall = b.waterfall()
+	}
+	b.mu.Unlock()
+
+	paths := make([]string, 0, len(totals))
+	for path := range totals {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		histogramOn(b.stats, path, int64(totals[path]/time.Millisecond))
+		histogramOn(b.stats, path+".self", int64(selves[path]/time.Millisecond))
+	}
+	if waterfall != "" {
+		b.Logger.Warn("slow request", "stat", b.root.name, "duration", b.root.duration, "waterfall", waterfall)
+	}
+}
+
+// one line per segment, indented by depth, with when it started relative
+// to the request and how long it took
+//
+//	checkout        +0s    120ms  self 20ms
+//	  db            +5ms   60ms   self 60ms
+//
+// callers must hold b.mu
+func (b *Breakdown) waterfall() string {
+	lines := []string{}
+	var walk func(seg *segment, depth int)
+	walk = func(seg *segment, depth int) {
+		lines = append(lines, fmt.Sprintf("%-24s +%-8v %-8v self %v",
+			strings.Repeat("  ", depth)+seg.name, seg.start.Sub(b.root.start), seg.duration, seg.self()))
+		for _, child := range seg.children {
+			walk(child, depth+1)
+		}
+	}
+	walk(b.root, 0)
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,129 @@
+package gstats
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/franela/goblin"
+	. "github.com/onsi/gomega"
+)
+
+func TestBreakdown(t *testing.T) {
+	g := Goblin(t)
+	RegisterFailHandler(func(m string, _ ...int) { g.Fail(m) })
+	g.Describe("Breakdown", func() {
+		var sock *net.UDPConn
+		var stats *Statistics
+		var clock *FakeClock
+		g.BeforeEach(func() {
+			var err error
+			sock, err = net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+			Expect(err).NotTo(HaveOccurred())
+			os.Setenv("STATSD_ADDRESS", sock.LocalAddr().String())
+			os.Setenv("STATSD_PREFIX", "test")
+			clock = NewFakeClock(time.Now())
+			stats, err = CreateStatsdClientWithOptions(Options{Clock: clock, BufferFlushPeriod: time.Hour})
+			Expect(err).NotTo(HaveOccurred())
+		})
+		g.AfterEach(func() {
+			sock.Close()
+		})
+		g.It("should send every segment's time and self time", func() {
+			ctx, breakdown := WithBreakdown(context.Background(), stats, "checkout")
+			clock.Advance(5 * time.Millisecond)
+			serviceCtx, endService := Segment(ctx, "service")
+			clock.Advance(10 * time.Millisecond)
+			for i := 0; i < 2; i++ {
+				_, endDB := Segment(serviceCtx, "db")
+				clock.Advance(30 * time.Millisecond)
+				endDB()
+			}
+			endService()
+			clock.Advance(5 * time.Millisecond)
+			breakdown.End()
+			breakdown.End()
+			Expect([]string{
+				helper_ReadUDP(sock), helper_ReadUDP(sock),
+				helper_ReadUDP(sock), helper_ReadUDP(sock),
+				helper_ReadUDP(sock), helper_ReadUDP(sock),
+			}).To(Equal([]string{
+				"test.checkout:80|ms",
+				"test.checkout.self:10|ms",
+				"test.checkout.service:70|ms",
+				"test.checkout.service.self:10|ms",
+				"test.checkout.service.db:60|ms",
+				"test.checkout.service.db.self:60|ms",
+			}))
+			sock.SetReadDeadline(time.Now().Add(20 * time.Millisecond))
+			_, _, err := sock.ReadFromUDP(make([]byte, 1024))
+			Expect(err).To(HaveOccurred())
+		})
+		g.It("should end segments that are still running with the request", func() {
+			ctx, breakdown := WithBreakdown(context.Background(), stats, "checkout")
+			Segment(ctx, "forgotten")
+			clock.Advance(20 * time.Millisecond)
+			breakdown.End()
+			Expect(helper_ReadUDP(sock)).To(Equal("test.checkout:20|ms"))
+			Expect(helper_ReadUDP(sock)).To(Equal("test.checkout.self:0|ms"))
+			Expect(helper_ReadUDP(sock)).To(Equal("test.checkout.forgotten:20|ms"))
+		})
+		g.It("should not count parallel segments below zero self time", func() {
+			ctx, breakdown := WithBreakdown(context.Background(), stats, "fanout")
+			wg := sync.WaitGroup{}
+			ends := make(chan func(), 3)
+			for i := 0; i < 3; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					_, end := Segment(ctx, "shard")
+					ends <- end
+				}()
+			}
+			wg.Wait()
+			clock.Advance(10 * time.Millisecond)
+			for i := 0; i < 3; i++ {
+				(<-ends)()
+			}
+			breakdown.End()
+			Expect(helper_ReadUDP(sock)).To(Equal("test.fanout:10|ms"))
+			Expect(helper_ReadUDP(sock)).To(Equal("test.fanout.self:0|ms"))
+			Expect(helper_ReadUDP(sock)).To(Equal("test.fanout.shard:30|ms"))
+		})
+		g.It("should time nothing outside a breakdown", func() {
+			ctx, end := Segment(context.Background(), "db")
+			end()
+			Expect(ctx).To(Equal(context.Background()))
+		})
+		g.It("should log a waterfall of slow requests", func() {
+			out := bytes.Buffer{}
+			ctx, breakdown := WithBreakdown(context.Background(), stats, "checkout")
+			breakdown.Logger = slog.New(slog.NewTextHandler(&out, nil))
+			breakdown.SlowerThan = 50 * time.Millisecond
+			clock.Advance(5 * time.Millisecond)
+			_, endDB := Segment(ctx, "db")
+			clock.Advance(60 * time.Millisecond)
+			endDB()
+			breakdown.End()
+			Expect(out.String()).To(ContainSubstring("msg=\"slow request\" stat=checkout duration=65ms"))
+			logged := strings.Replace(out.String(), `\n`, "\n", -1)
+			Expect(logged).To(MatchRegexp(`checkout +\+0s +65ms +self 5ms`))
+			Expect(logged).To(MatchRegexp(`\n  db +\+5ms +60ms +self 60ms`))
+		})
+		g.It("should not log fast requests", func() {
+			out := bytes.Buffer{}
+			_, breakdown := WithBreakdown(context.Background(), stats, "checkout")
+			breakdown.Logger = slog.New(slog.NewTextHandler(&out, nil))
+			breakdown.SlowerThan = 50 * time.Millisecond
+			clock.Advance(10 * time.Millisecond)
+			breakdown.End()
+			Expect(out.String()).To(BeEmpty())
+		})
+	})
+}
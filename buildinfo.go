@@ -0,0 +1,56 @@
+package gstats
+
+import (
+	"runtime/debug"
+	"strings"
+)
+
+// build_info.<module version>.<vcs revision>.<go version>, statsd has no
+// tags so the build is spelled out in the name, e.g.
+// "build_info.v1_4_0.3f9c2a1b7d0e.go1_22_1"
+func buildInfoStat(info *debug.BuildInfo, ok bool) string {
+	version, revision, goVersion := "unknown", "unknown", "unknown"
+	if ok {
+		if info.Main.Version != "" {
+			version = info.Main.Version
+		}
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" && setting.Value != "" {
+				revision = setting.Value
+				if len(revision) > 12 {
+					revision = revision[:12]
+				}
+			}
+		}
+		if info.GoVersion != "" {
+			goVersion = info.GoVersion
+		}
+	}
+	return "build_info." + statSegment(version) + "." + statSegment(revision) + "." + statSegment(goVersion)
+}
+
+// keeps a value in one path segment, "(devel)" => "devel", "v1.2.3" => "v1_2_3"
+func statSegment(value string) string {
+	value = strings.Trim(value, "()")
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		}
+		return '_'
+	}, value)
+}
+
+// a gauge of 1, so summing build_info.* per version shows how many processes
+// run each build
+func (s *Statistics) sendBuildInfo() {
+	s.client.Gauge(buildInfoStat(debug.ReadBuildInfo()), 1, 1.0)
+}
+
+// sent on every tick of the flush loop, a process that stops sending
+// heartbeat.count is gone or stuck
+func (s *Statistics) sendHeartbeat() {
+	s.sendBuildInfo()
+	s.client.Gauge("uptime_seconds", int64(s.clock.Now().Sub(s.started).Seconds()), 1.0)
+	s.Inc("heartbeat")
+}
@@ -0,0 +1,88 @@
+package gstats
+
+import (
+	"net"
+	"os"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/franela/goblin"
+	. "github.com/onsi/gomega"
+)
+
+func TestBuildInfo(t *testing.T) {
+	g := Goblin(t)
+	RegisterFailHandler(func(m string, _ ...int) { g.Fail(m) })
+	g.Describe("Build info", func() {
+		g.It("should spell the build out in the stat name", func() {
+			info := &debug.BuildInfo{
+				GoVersion: "go1.22.1",
+				Main:      debug.Module{Path: "example.com/service", Version: "v1.4.0"},
+				Settings: []debug.BuildSetting{
+					{Key: "vcs", Value: "git"},
+					{Key: "vcs.revision", Value: "3f9c2a1b7d0e55aa9c0f1e2d3c4b5a6978877665"},
+				},
+			}
+			Expect(buildInfoStat(info, true)).To(Equal("build_info.v1_4_0.3f9c2a1b7d0e.go1_22_1"))
+		})
+		g.It("should fill in what is not known", func() {
+			Expect(buildInfoStat(nil, false)).To(Equal("build_info.unknown.unknown.unknown"))
+			info := &debug.BuildInfo{GoVersion: "go1.22.1", Main: debug.Module{Version: "(devel)"}}
+			Expect(buildInfoStat(info, true)).To(Equal("build_info.devel.unknown.go1_22_1"))
+		})
+	})
+	g.Describe("Heartbeat", func() {
+		var sock *net.UDPConn
+		var clock *FakeClock
+		g.BeforeEach(func() {
+			var err error
+			sock, err = net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+			Expect(err).NotTo(HaveOccurred())
+			os.Setenv("STATSD_ADDRESS", sock.LocalAddr().String())
+			os.Setenv("STATSD_PREFIX", "test")
+			clock = NewFakeClock(time.Now())
+		})
+		g.AfterEach(func() {
+			sock.Close()
+			os.Unsetenv("STATSD_HEARTBEAT")
+		})
+		g.It("should send build info on startup and a heartbeat on every flush tick", func() {
+			stats, err := CreateStatsdClientWithOptions(Options{Clock: clock, Heartbeat: true})
+			Expect(err).NotTo(HaveOccurred())
+			buildInfo := helper_ReadUDP(sock)
+			Expect(strings.HasPrefix(buildInfo, "test.build_info.")).To(BeTrue())
+			Expect(strings.HasSuffix(buildInfo, ":1|g")).To(BeTrue())
+
+			// a manual flush is not a tick
+			stats.Flush()
+			for tick := 1; tick <= 2; tick++ {
+				clock.BlockUntil(1)
+				clock.Advance(time.Second)
+				Expect(helper_ReadUDP(sock)).To(Equal(buildInfo))
+				Expect(helper_ReadUDP(sock)).To(Equal("test.uptime_seconds:" + strconv.Itoa(tick) + "|g"))
+				Expect(helper_ReadUDP(sock)).To(Equal("test.heartbeat.count:1|c"))
+			}
+		})
+		g.It("should be switched on from the environment", func() {
+			os.Setenv("STATSD_HEARTBEAT", "true")
+			_, err := CreateStatsdClientWithOptions(Options{Clock: clock})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(strings.HasPrefix(helper_ReadUDP(sock), "test.build_info.")).To(BeTrue())
+			os.Setenv("STATSD_HEARTBEAT", "sometimes")
+			_, err = CreateStatsdClientWithOptions(Options{Clock: clock})
+			Expect(err).To(HaveOccurred())
+		})
+		g.It("should be off by default", func() {
+			_, err := CreateStatsdClientWithOptions(Options{Clock: clock})
+			Expect(err).NotTo(HaveOccurred())
+			clock.BlockUntil(1)
+			clock.Advance(time.Second)
+			sock.SetReadDeadline(time.Now().Add(20 * time.Millisecond))
+			_, _, err = sock.ReadFromUDP(make([]byte, 1024))
+			Expect(err).To(HaveOccurred())
+		})
+	})
+}
@@ -0,0 +1,142 @@
+package gstats
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// memory limits at or above this mean no limit, cgroup v1 reports "no
+// limit" as the largest page aligned int64
+const cgroupUnlimited = 1 << 62
+
+// CgroupCollector reads the resources of the container the process runs in
+// from its cgroup, cgroup v1 and v2 are both understood:
+//
+//	cpu.quota_millicores          CPU the container may use, 1000 per core
+//	memory.usage_bytes, memory.limit_bytes
+//
+// and as counters of what happened since the last collection:
+//
+//	cpu.periods, cpu.throttled_periods, cpu.throttled_ms
+//	memory.oom_kills
+//
+// > stats.RegisterCollector("container", gstats.NewCgroupCollector(""), 0)
+//
+// Limits that are not set and files that cannot be read are skipped.
+type CgroupCollector struct {
+	// where the cgroup filesystem is mounted, tests point this at a
+	// fixture directory
+	Root string
+	// 1 or 2, worked out from Root by NewCgroupCollector
+	Version int
+
+	mu sync.Mutex
+	// the totals read last time, counters send the difference
+	totals map[string]int64
+}
+
+// "" reads the real /sys/fs/cgroup
+func NewCgroupCollector(root string) *CgroupCollector {
+	if root == "" {
+		root = "/sys/fs/cgroup"
+	}
+	version := 1
+	// only the unified hierarchy has cgroup.controllers at its root
+	if _, err := os.Stat(filepath.Join(root, "cgroup.controllers")); err == nil {
+		version = 2
+	}
+	return &CgroupCollector{Root: root, Version: version, totals: map[string]int64{}}
+}
+
+// cgroup v1 keeps every controller in its own hierarchy, some systems only
+// mount cpu combined with cpuacct
+func (c *CgroupCollector) v1(controller, file string) string {
+	dir := filepath.Join(c.Root, controller)
+	if _, err := os.Stat(dir); err != nil && controller == "cpu" {
+		dir = filepath.Join(c.Root, "cpu,cpuacct")
+	}
+	return filepath.Join(dir, file)
+}
+
+func (c *CgroupCollector) Collect(emit func(name string, value float64)) {
+	if c.Version == 2 {
+		// "50000 100000", or "max 100000" without a quota
+		if fields := strings.Fields(readFileString(filepath.Join(c.Root, "cpu.max"))); len(fields) == 2 {
+			quota, quotaErr := strconv.ParseFloat(fields[0], 64)
+			period, periodErr := strconv.ParseFloat(fields[1], 64)
+			if quotaErr == nil && periodErr == nil && period > 0 {
+				emit("cpu.quota_millicores", quota/period*1000)
+			}
+		}
+		if usage, ok := readFileInt(filepath.Join(c.Root, "memory.current")); ok {
+			emit("memory.usage_bytes", float64(usage))
+		}
+		if limit, ok := readFileInt(filepath.Join(c.Root, "memory.max")); ok && limit < cgroupUnlimited {
+			emit("memory.limit_bytes", float64(limit))
+		}
+		return
+	}
+	quota, quotaOk := readFileInt(c.v1("cpu", "cpu.cfs_quota_us"))
+	period, periodOk := readFileInt(c.v1("cpu", "cpu.cfs_period_us"))
+	// the quota is -1 without a limit
+	if quotaOk && periodOk && quota > 0 && period > 0 {
+		emit("cpu.quota_millicores", float64(quota)/float64(period)*1000)
+	}
+	if usage, ok := readFileInt(c.v1("memory", "memory.usage_in_bytes")); ok {
+		emit("memory.usage_bytes", float64(usage))
+	}
+	if limit, ok := readFileInt(c.v1("memory", "memory.limit_in_bytes")); ok && limit < cgroupUnlimited {
+		emit("memory.limit_bytes", float64(limit))
+	}
+}
+
+func (c *CgroupCollector) CollectCounters(count func(name string, delta int64)) {
+	totals := map[string]int64{}
+	if c.Version == 2 {
+		cpu := readKeyValues(filepath.Join(c.Root, "cpu.stat"), " ")
+		setTotal(totals, cpu, "nr_periods", "cpu.periods", 1)
+		setTotal(totals, cpu, "nr_throttled", "cpu.throttled_periods", 1)
+		setTotal(totals, cpu, "throttled_usec", "cpu.throttled_ms", 1000)
+		setTotal(totals, readKeyValues(filepath.Join(c.Root, "memory.events"), " "), "oom_kill", "memory.oom_kills", 1)
+	} else {
+		cpu := readKeyValues(c.v1("cpu", "cpu.stat"), " ")
+		setTotal(totals, cpu, "nr_periods", "cpu.periods", 1)
+		setTotal(totals, cpu, "nr_throttled", "cpu.throttled_periods", 1)
+		setTotal(totals, cpu, "throttled_time", "cpu.throttled_ms", 1000000)
+		// only kernels since 4.13 count oom kills here
+		setTotal(totals, readKeyValues(c.v1("memory", "memory.oom_control"), " "), "oom_kill", "memory.oom_kills", 1)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for name, total := range totals {
+		// the first collection only sets the baseline, and a total that went
+		// down belongs to a cgroup that was recreated
+		if last, ok := c.totals[name]; ok && total > last {
+			count(name, total-last)
+		}
+		c.totals[name] = total
+	}
+}
+
+func setTotal(totals map[string]int64, values map[string]float64, key, name string, divisor float64) {
+	if value, ok := values[key]; ok {
+		totals[name] = int64(value / divisor)
+	}
+}
+
+func readFileString(path string) string {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(contents))
+}
+
+// false when the file is missing or does not hold a number, e.g. "max"
+func readFileInt(path string) (int64, bool) {
+	value, err := strconv.ParseInt(readFileString(path), 10, 64)
+	return value, err == nil
+}
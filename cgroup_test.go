@@ -0,0 +1,105 @@
+package gstats
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/franela/goblin"
+	. "github.com/onsi/gomega"
+)
+
+func helper_CollectCounters(c CounterCollector) map[string]int64 {
+	deltas := map[string]int64{}
+	c.CollectCounters(func(name string, delta int64) { deltas[name] = delta })
+	return deltas
+}
+
+func helper_WriteCgroupV2(dir string, periods, throttled, throttledUsec, oomKills string) {
+	os.WriteFile(filepath.Join(dir, "cgroup.controllers"), []byte("cpu memory\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "cpu.max"), []byte("200000 100000\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "cpu.stat"), []byte("nr_periods "+periods+"\nnr_throttled "+throttled+"\nthrottled_usec "+throttledUsec+"\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "memory.events"), []byte("oom 0\noom_kill "+oomKills+"\n"), 0644)
+}
+
+func TestCgroupCollector(t *testing.T) {
+	g := Goblin(t)
+	RegisterFailHandler(func(m string, _ ...int) { g.Fail(m) })
+	g.Describe("CgroupCollector", func() {
+		g.It("should detect the cgroup version", func() {
+			Expect(NewCgroupCollector("testdata/cgroup/v1").Version).To(Equal(1))
+			Expect(NewCgroupCollector("testdata/cgroup/v2").Version).To(Equal(2))
+		})
+		g.It("should read cgroup v1 limits and usage", func() {
+			Expect(helper_Collect(NewCgroupCollector("testdata/cgroup/v1"))).To(Equal(map[string]float64{
+				"cpu.quota_millicores": 1500,
+				"memory.usage_bytes":   268435456,
+				"memory.limit_bytes":   536870912,
+			}))
+		})
+		g.It("should read cgroup v2 limits and usage", func() {
+			Expect(helper_Collect(NewCgroupCollector("testdata/cgroup/v2"))).To(Equal(map[string]float64{
+				"cpu.quota_millicores": 500,
+				"memory.usage_bytes":   104857600,
+				"memory.limit_bytes":   209715200,
+			}))
+		})
+		g.It("should skip limits that are not set", func() {
+			Expect(helper_Collect(NewCgroupCollector("testdata/cgroup/v2-unlimited"))).To(Equal(map[string]float64{
+				"memory.usage_bytes": 1048576,
+			}))
+		})
+		g.It("should count what happened since the last collection", func() {
+			for _, root := range []string{"testdata/cgroup/v1", "testdata/cgroup/v2"} {
+				c := NewCgroupCollector(root)
+				Expect(helper_CollectCounters(c)).To(BeEmpty())
+				Expect(helper_CollectCounters(c)).To(BeEmpty())
+			}
+
+			dir, err := os.MkdirTemp("", "cgroup")
+			Expect(err).NotTo(HaveOccurred())
+			defer os.RemoveAll(dir)
+			helper_WriteCgroupV2(dir, "100", "10", "50000", "0")
+			c := NewCgroupCollector(dir)
+			Expect(helper_CollectCounters(c)).To(BeEmpty())
+			helper_WriteCgroupV2(dir, "160", "14", "80000", "1")
+			Expect(helper_CollectCounters(c)).To(Equal(map[string]int64{
+				"cpu.periods":           60,
+				"cpu.throttled_periods": 4,
+				"cpu.throttled_ms":      30,
+				"memory.oom_kills":      1,
+			}))
+			// recreated cgroups start over
+			helper_WriteCgroupV2(dir, "5", "0", "0", "0")
+			Expect(helper_CollectCounters(c)).To(BeEmpty())
+			helper_WriteCgroupV2(dir, "7", "0", "0", "0")
+			Expect(helper_CollectCounters(c)).To(Equal(map[string]int64{"cpu.periods": 2}))
+		})
+		g.It("should send gauges and then counters once registered", func() {
+			dir, err := os.MkdirTemp("", "cgroup")
+			Expect(err).NotTo(HaveOccurred())
+			defer os.RemoveAll(dir)
+			helper_WriteCgroupV2(dir, "100", "10", "50000", "0")
+			sock, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+			Expect(err).NotTo(HaveOccurred())
+			defer sock.Close()
+			os.Setenv("STATSD_ADDRESS", sock.LocalAddr().String())
+			os.Setenv("STATSD_PREFIX", "test")
+			clock := NewFakeClock(time.Now())
+			stats, err := CreateStatsdClientWithOptions(Options{Clock: clock, BufferFlushPeriod: time.Hour})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stats.RegisterCollector("container", NewCgroupCollector(dir), time.Second)).NotTo(HaveOccurred())
+			clock.BlockUntil(2)
+			clock.Advance(time.Second)
+			Expect(helper_ReadUDP(sock)).To(Equal("test.container.cpu.quota_millicores:2000|g"))
+			Expect(helper_ReadUDP(sock)).To(Equal("test.container.collect_time:0|ms"))
+			helper_WriteCgroupV2(dir, "100", "10", "50000", "3")
+			clock.BlockUntil(2)
+			clock.Advance(time.Second)
+			Expect(helper_ReadUDP(sock)).To(Equal("test.container.cpu.quota_millicores:2000|g"))
+			Expect(helper_ReadUDP(sock)).To(Equal("test.container.memory.oom_kills:3|c"))
+		})
+	})
+}
@@ -0,0 +1,112 @@
+package gstats
+
+import (
+	"math/rand"
+	"net"
+	"strconv"
+)
+
+// the subset of a statsd client that Statistics relies on
+type sender interface {
+	Inc(stat string, value int64, rate float32) error
+	Gauge(stat string, value int64, rate float32) error
+	Timing(stat string, delta int64, rate float32) error
+	// a timer with fractions of a millisecond and DogStatsD tags,
+	// "name:value,name:value", tags may be empty
+	preciseTiming(stat string, milliseconds float64, tags string) error
+	// write delivers a line that is already in wire format, stat is only
+	// used to route it
+	write(stat string, line []byte) error
+	Close() error
+}
+
+// formats stats in the statsd line protocol, "prefix.stat:value|type", and
+// hands each line to a transport
+type statsdClient struct {
+	prefix    string
+	transport transport
+}
+
+func newStatsdClient(opts Options) (*statsdClient, error) {
+	network, address, err := parseAddress(opts.Address)
+	if err != nil {
+		return nil, err
+	}
+	t, err := openTransport(network, address, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &statsdClient{opts.Prefix, t}, nil
+}
+
+// hostnames are re-resolved when asked to, IP literals and socket paths
+// never change
+func openTransport(network, address string, opts Options) (transport, error) {
+	if opts.ResolveInterval > 0 && (network == "udp" || network == "tcp") {
+		host, _, err := net.SplitHostPort(address)
+		if err == nil && net.ParseIP(host) == nil {
+			return newResolvingTransport(network, address, opts.Resolver, opts.ResolveInterval)
+		}
+	}
+	return newTransport(network, address)
+}
+
+func (c *statsdClient) Inc(stat string, value int64, rate float32) error {
+	return c.send(stat, value, "c", rate, "")
+}
+
+func (c *statsdClient) Gauge(stat string, value int64, rate float32) error {
+	return c.send(stat, value, "g", rate, "")
+}
+
+func (c *statsdClient) Timing(stat string, delta int64, rate float32) error {
+	return c.send(stat, delta, "ms", rate, "")
+}
+
+func (c *statsdClient) preciseTiming(stat string, milliseconds float64, tags string) error {
+	line := c.appendName(make([]byte, 0, len(c.prefix)+len(stat)+len(tags)+32), stat)
+	line = strconv.AppendFloat(line, milliseconds, 'f', -1, 64)
+	line = append(line, "|ms"...)
+	return c.transport.Write(appendTags(line, tags))
+}
+
+func (c *statsdClient) write(stat string, line []byte) error {
+	return c.transport.Write(line)
+}
+
+func (c *statsdClient) Close() error {
+	return c.transport.Close()
+}
+
+func (c *statsdClient) send(stat string, value int64, suffix string, rate float32, tags string) error {
+	if rate < 1 && rand.Float32() >= rate {
+		return nil
+	}
+	line := c.appendName(make([]byte, 0, len(c.prefix)+len(stat)+len(tags)+32), stat)
+	line = strconv.AppendInt(line, value, 10)
+	line = append(line, '|')
+	line = append(line, suffix...)
+	if rate < 1 {
+		line = append(line, "|@"...)
+		line = strconv.AppendFloat(line, float64(rate), 'f', -1, 32)
+	}
+	return c.transport.Write(appendTags(line, tags))
+}
+
+// "prefix.stat:"
+func (c *statsdClient) appendName(line []byte, stat string) []byte {
+	if c.prefix != "" {
+		line = append(line, c.prefix...)
+		line = append(line, '.')
+	}
+	line = append(line, stat...)
+	return append(line, ':')
+}
+
+func appendTags(line []byte, tags string) []byte {
+	if tags == "" {
+		return line
+	}
+	line = append(line, "|#"...)
+	return append(line, tags...)
+}
@@ -0,0 +1,20 @@
+package gstats
+
+import "time"
+
+// Clock is where Statistics gets the time from. Tests can swap in a
+// FakeClock to drive timers and the flush loop without sleeping.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
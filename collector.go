@@ -0,0 +1,123 @@
+package gstats
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+// Collector reads a set of values on a schedule, see RegisterCollector.
+// Collect calls emit once per value, names are relative to the name the
+// collector was registered under and an empty name means the registered name
+// itself.
+type Collector interface {
+	Collect(emit func(name string, value float64))
+}
+
+// Collectors that read ever growing totals, like the number of times
+// something happened, can also implement CounterCollector. The deltas passed
+// to count are sent as counters, after the gauges of the same collection.
+type CounterCollector interface {
+	CollectCounters(count func(name string, delta int64))
+}
+
+// GaugeFunc is a Collector of a single value
+type GaugeFunc func() float64
+
+func (f GaugeFunc) Collect(emit func(name string, value float64)) {
+	emit("", f())
+}
+
+type registeredCollector struct {
+	name      string
+	collector Collector
+	interval  time.Duration
+	stop      chan bool
+}
+
+// stats.RegisterGaugeFunc("queue.length", func() float64 { return float64(len(jobs)) })
+// sends the value as a gauge every BufferFlushPeriod until Unregister("queue.length")
+func (s *Statistics) RegisterGaugeFunc(name string, f func() float64) error {
+	return s.RegisterCollector(name, GaugeFunc(f), 0)
+}
+
+// stats.RegisterCollector("cache", cache, 10*time.Second) calls cache.Collect
+// every 10 seconds, sending every value as a gauge under "cache.". A zero
+// interval means BufferFlushPeriod. Values are rounded to whole numbers.
+// Each collection is timed to the microsecond as "name.collect_time" and a
+// collector that panics is counted like RecoverAndCount, in
+// "name.panic.<what panicked>.count", and polled again next time. After
+// Close it returns an error.
+func (s *Statistics) RegisterCollector(name string, c Collector, interval time.Duration) error {
+	if name == "" {
+		return errors.New("collectors need a name")
+	}
+	if interval <= 0 {
+		interval = s.BufferFlushPeriod
+	}
+	s.mu <- true
+	defer func() { <-s.mu }()
+	select {
+	case <-s.done:
+		return errors.New("cannot register collector \"" + name + "\" on a closed client")
+	default:
+	}
+	if _, ok := s.collectors[name]; ok {
+		return errors.New("a collector named \"" + name + "\" is already registered")
+	}
+	r := &registeredCollector{name, c, interval, make(chan bool)}
+	s.collectors[name] = r
+	go s.pollCollector(r)
+	return nil
+}
+
+// stops polling the collector registered under name, if there is one
+func (s *Statistics) Unregister(name string) {
+	s.mu <- true
+	defer func() { <-s.mu }()
+	if r, ok := s.collectors[name]; ok {
+		close(r.stop)
+		delete(s.collectors, name)
+	}
+}
+
+func (s *Statistics) pollCollector(r *registeredCollector) {
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-s.clock.After(r.interval):
+		}
+		select {
+		case <-r.stop:
+			return
+		default:
+		}
+		s.collect(r)
+	}
+}
+
+func (s *Statistics) collect(r *registeredCollector) {
+	start := s.clock.Now()
+	defer func() {
+		if p := recover(); p != nil {
+			countPanic(s, r.name, p)
+		}
+		timeOn(s, r.name+".collect_time", s.clock.Now().Sub(start))
+	}()
+	r.collector.Collect(func(name string, value float64) {
+		s.client.Gauge(r.stat(name), int64(math.Round(value)), 1.0)
+	})
+	if counters, ok := r.collector.(CounterCollector); ok {
+		counters.CollectCounters(func(name string, delta int64) {
+			s.client.Inc(r.stat(name), delta, 1.0)
+		})
+	}
+}
+
+func (r *registeredCollector) stat(name string) string {
+	if name == "" {
+		return r.name
+	}
+	return r.name + "." + name
+}
@@ -0,0 +1,101 @@
+package gstats
+
+import (
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	. "github.com/franela/goblin"
+	. "github.com/onsi/gomega"
+)
+
+type helper_SlowCollector struct {
+	clock *FakeClock
+}
+
+func (c helper_SlowCollector) Collect(emit func(string, float64)) {
+	emit("hits", 41.6)
+	emit("misses", 3)
+	c.clock.Advance(2250 * time.Microsecond)
+}
+
+type helper_PanickingCollector struct{}
+
+func (helper_PanickingCollector) Collect(emit func(string, float64)) {
+	panic("collector bug")
+}
+
+func TestCollectors(t *testing.T) {
+	g := Goblin(t)
+	RegisterFailHandler(func(m string, _ ...int) { g.Fail(m) })
+	g.Describe("Collectors", func() {
+		var sock *net.UDPConn
+		var stats *Statistics
+		var clock *FakeClock
+		g.BeforeEach(func() {
+			var err error
+			sock, err = net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+			Expect(err).NotTo(HaveOccurred())
+			os.Setenv("STATSD_ADDRESS", sock.LocalAddr().String())
+			os.Setenv("STATSD_PREFIX", "test")
+			clock = NewFakeClock(time.Now())
+			stats, err = CreateStatsdClientWithOptions(Options{Clock: clock, BufferFlushPeriod: time.Hour})
+			Expect(err).NotTo(HaveOccurred())
+			// the flush loop
+			clock.BlockUntil(1)
+		})
+		g.AfterEach(func() {
+			sock.Close()
+		})
+		g.It("should poll gauge funcs every BufferFlushPeriod", func() {
+			length := 3.0
+			Expect(stats.RegisterGaugeFunc("queue.length", func() float64 { return length })).NotTo(HaveOccurred())
+			clock.BlockUntil(2)
+			clock.Advance(time.Hour)
+			Expect(helper_ReadUDP(sock)).To(Equal("test.queue.length:3|g"))
+			Expect(helper_ReadUDP(sock)).To(Equal("test.queue.length.collect_time:0|ms"))
+		})
+		g.It("should poll collectors on their own interval and time them", func() {
+			Expect(stats.RegisterCollector("cache", helper_SlowCollector{clock}, 10*time.Second)).NotTo(HaveOccurred())
+			clock.BlockUntil(2)
+			clock.Advance(10 * time.Second)
+			Expect(helper_ReadUDP(sock)).To(Equal("test.cache.hits:42|g"))
+			Expect(helper_ReadUDP(sock)).To(Equal("test.cache.misses:3|g"))
+			Expect(helper_ReadUDP(sock)).To(Equal("test.cache.collect_time:2.25|ms"))
+			clock.BlockUntil(2)
+			clock.Advance(10 * time.Second)
+			Expect(helper_ReadUDP(sock)).To(Equal("test.cache.hits:42|g"))
+		})
+		g.It("should refuse two collectors with the same name", func() {
+			Expect(stats.RegisterGaugeFunc("pool.size", func() float64 { return 1 })).NotTo(HaveOccurred())
+			Expect(stats.RegisterGaugeFunc("pool.size", func() float64 { return 2 })).To(HaveOccurred())
+			Expect(stats.RegisterGaugeFunc("", func() float64 { return 2 })).To(HaveOccurred())
+		})
+		g.It("should refuse collectors once the client is closed", func() {
+			Expect(stats.Close()).NotTo(HaveOccurred())
+			Expect(stats.RegisterGaugeFunc("late", func() float64 { return 1 })).To(HaveOccurred())
+		})
+		g.It("should count panics and keep polling", func() {
+			Expect(stats.RegisterCollector("broken", helper_PanickingCollector{}, time.Second)).NotTo(HaveOccurred())
+			for i := 0; i < 2; i++ {
+				clock.BlockUntil(2)
+				clock.Advance(time.Second)
+				Expect(helper_ReadUDP(sock)).To(Equal("test.broken.panic.String.count:1|c"))
+				Expect(helper_ReadUDP(sock)).To(Equal("test.broken.collect_time:0|ms"))
+			}
+		})
+		g.It("should stop polling unregistered collectors", func() {
+			Expect(stats.RegisterGaugeFunc("gone", func() float64 { return 1 })).NotTo(HaveOccurred())
+			Expect(stats.RegisterCollector("kept", GaugeFunc(func() float64 { return 2 }), time.Hour)).NotTo(HaveOccurred())
+			clock.BlockUntil(3)
+			stats.Unregister("gone")
+			stats.Unregister("never registered")
+			clock.Advance(time.Hour)
+			Expect(helper_ReadUDP(sock)).To(Equal("test.kept:2|g"))
+			Expect(helper_ReadUDP(sock)).To(Equal("test.kept.collect_time:0|ms"))
+			// the name is free again
+			Expect(stats.RegisterGaugeFunc("gone", func() float64 { return 3 })).NotTo(HaveOccurred())
+		})
+	})
+}
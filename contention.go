@@ -0,0 +1,157 @@
+package gstats
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// locks timed out of every SampleEvery when it is not set
+const defaultSampleEvery = 100
+
+// InstrumentedMutex is a sync.Mutex that times how long Lock waited and how
+// long the lock was held, for one in SampleEvery locks. Both are sent after
+// Unlock as timers to the microsecond, "stat.wait" and "stat.hold".
+// A nil Stats means Default().
+// > cacheLock := gstats.InstrumentedMutex{Stats: stats, Stat: "cache.lock"}
+type InstrumentedMutex struct {
+	Stats       Statser
+	Stat        string
+	SampleEvery uint64
+
+	mu    sync.Mutex
+	locks atomic.Uint64
+	// only touched while mu is held
+	sampled  bool
+	wait     time.Duration
+	acquired time.Time
+}
+
+func sampleThis(locks *atomic.Uint64, every uint64) bool {
+	if every == 0 {
+		every = defaultSampleEvery
+	}
+	return locks.Add(1)%every == 0
+}
+
+func (m *InstrumentedMutex) Lock() {
+	if !sampleThis(&m.locks, m.SampleEvery) {
+		m.mu.Lock()
+		m.sampled = false
+		return
+	}
+	start := time.Now()
+	m.mu.Lock()
+	m.acquired = time.Now()
+	m.wait = m.acquired.Sub(start)
+	m.sampled = true
+}
+
+func (m *InstrumentedMutex) Unlock() {
+	if !m.sampled {
+		m.mu.Unlock()
+		return
+	}
+	hold := time.Since(m.acquired)
+	wait := m.wait
+	m.sampled = false
+	m.mu.Unlock()
+	sendLockTimes(m.Stats, m.Stat, wait, hold)
+}
+
+// InstrumentedRWMutex is a sync.RWMutex timed like InstrumentedMutex. Read
+// locks can be held by many goroutines at once, so only how long RLock
+// waited is timed, as "stat.read_wait".
+type InstrumentedRWMutex struct {
+	Stats       Statser
+	Stat        string
+	SampleEvery uint64
+
+	mu    sync.RWMutex
+	locks atomic.Uint64
+	// only touched while mu is held for writing
+	sampled  bool
+	wait     time.Duration
+	acquired time.Time
+}
+
+func (m *InstrumentedRWMutex) Lock() {
+	if !sampleThis(&m.locks, m.SampleEvery) {
+		m.mu.Lock()
+		m.sampled = false
+		return
+	}
+	start := time.Now()
+	m.mu.Lock()
+	m.acquired = time.Now()
+	m.wait = m.acquired.Sub(start)
+	m.sampled = true
+}
+
+func (m *InstrumentedRWMutex) Unlock() {
+	if !m.sampled {
+		m.mu.Unlock()
+		return
+	}
+	hold := time.Since(m.acquired)
+	wait := m.wait
+	m.sampled = false
+	m.mu.Unlock()
+	sendLockTimes(m.Stats, m.Stat, wait, hold)
+}
+
+func (m *InstrumentedRWMutex) RLock() {
+	if !sampleThis(&m.locks, m.SampleEvery) {
+		m.mu.RLock()
+		return
+	}
+	start := time.Now()
+	m.mu.RLock()
+	timeOn(statserOrDefault(m.Stats), m.Stat+".read_wait", time.Since(start))
+}
+
+func (m *InstrumentedRWMutex) RUnlock() {
+	m.mu.RUnlock()
+}
+
+func sendLockTimes(s Statser, stat string, wait, hold time.Duration) {
+	s = statserOrDefault(s)
+	timeOn(s, stat+".wait", wait)
+	timeOn(s, stat+".hold", hold)
+}
+
+func statserOrDefault(s Statser) Statser {
+	if s == nil {
+		return Default()
+	}
+	return s
+}
+
+// ChannelCollector gauges how full a channel is, as "len" and "cap" under
+// the name it is registered with
+// > stats.RegisterCollector("jobs.queue", gstats.ChannelCollector(jobs), 0)
+func ChannelCollector[T any](ch chan T) Collector {
+	return channelCollector(func() (int, int) { return len(ch), cap(ch) })
+}
+
+type channelCollector func() (int, int)
+
+func (c channelCollector) Collect(emit func(name string, value float64)) {
+	length, capacity := c()
+	emit("len", float64(length))
+	emit("cap", float64(capacity))
+}
+
+// Send sends v on ch like ch <- v. When the send has to wait for room, how
+// long it waited is sent as a timer to the microsecond, "stat.blocked".
+// > gstats.Send(stats, "jobs.queue", jobs, job)
+func Send[T any](s Statser, stat string, ch chan<- T, v T) {
+	select {
+	case ch <- v:
+		return
+	default:
+	}
+	start := time.Now()
+	ch <- v
+	timeOn(statserOrDefault(s), stat+".blocked", time.Since(start))
+}
@@ -0,0 +1,154 @@
+package gstats
+
+import (
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/franela/goblin"
+	. "github.com/onsi/gomega"
+)
+
+func helper_EndNames(mock *MockStatser) []string {
+	mu.Lock()
+	defer mu.Unlock()
+	names := []string{}
+	for _, call := range mock.CallsToEnd {
+		names = append(names, call.Str)
+	}
+	return names
+}
+
+func TestContention(t *testing.T) {
+	g := Goblin(t)
+	RegisterFailHandler(func(m string, _ ...int) { g.Fail(m) })
+	g.Describe("InstrumentedMutex", func() {
+		var mock MockStatser
+		g.BeforeEach(func() {
+			mock = NewMock()
+		})
+		g.It("should time waiting for and holding the lock", func() {
+			m := &InstrumentedMutex{Stats: &mock, Stat: "cache.lock", SampleEvery: 1}
+			m.Lock()
+			released := make(chan bool)
+			go func() {
+				time.Sleep(5 * time.Millisecond)
+				m.Unlock()
+				close(released)
+			}()
+			m.Lock()
+			m.Unlock()
+			<-released
+			// both unlocks send, in whichever order they get there
+			earliest := map[string]time.Time{}
+			for _, call := range mock.CallsToEnd {
+				if started, ok := earliest[call.Str]; !ok || call.Tim.Before(started) {
+					earliest[call.Str] = call.Tim
+				}
+			}
+			Expect(len(mock.CallsToEnd)).To(Equal(4))
+			// the first lock was held while the second waited
+			Expect(time.Since(earliest["cache.lock.hold"])).To(BeNumerically(">=", 5*time.Millisecond))
+			Expect(time.Since(earliest["cache.lock.wait"])).To(BeNumerically(">=", 4*time.Millisecond))
+		})
+		g.It("should send the times to the microsecond", func() {
+			sock, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+			Expect(err).NotTo(HaveOccurred())
+			defer sock.Close()
+			os.Setenv("STATSD_ADDRESS", sock.LocalAddr().String())
+			os.Setenv("STATSD_PREFIX", "test")
+			stats, err := CreateStatsdClient()
+			Expect(err).NotTo(HaveOccurred())
+			defer stats.Close()
+			sendLockTimes(stats, "cache.lock", 250*time.Microsecond, 1500*time.Microsecond)
+			Expect(helper_ReadUDP(sock)).To(Equal("test.cache.lock.wait:0.25|ms"))
+			Expect(helper_ReadUDP(sock)).To(Equal("test.cache.lock.hold:1.5|ms"))
+		})
+		g.It("should only time a sample of the locks", func() {
+			m := &InstrumentedMutex{Stats: &mock, Stat: "cache.lock", SampleEvery: 10}
+			for i := 0; i < 100; i++ {
+				m.Lock()
+				m.Unlock()
+			}
+			Expect(len(mock.CallsToEnd)).To(Equal(20))
+			m = &InstrumentedMutex{Stats: &mock, Stat: "other.lock"}
+			for i := 0; i < 100; i++ {
+				m.Lock()
+				m.Unlock()
+			}
+			Expect(len(mock.CallsToEnd)).To(Equal(22))
+		})
+		g.It("should still exclude", func() {
+			m := &InstrumentedMutex{Stats: &mock, Stat: "counter.lock", SampleEvery: 3}
+			total := 0
+			wg := sync.WaitGroup{}
+			for i := 0; i < 8; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for j := 0; j < 1000; j++ {
+						m.Lock()
+						total++
+						m.Unlock()
+					}
+				}()
+			}
+			wg.Wait()
+			Expect(total).To(Equal(8000))
+		})
+	})
+	g.Describe("InstrumentedRWMutex", func() {
+		g.It("should time writers like a mutex and readers' waits", func() {
+			mock := NewMock()
+			m := &InstrumentedRWMutex{Stats: &mock, Stat: "config.lock", SampleEvery: 1}
+			m.RLock()
+			m.RLock()
+			m.RUnlock()
+			m.RUnlock()
+			m.Lock()
+			m.Unlock()
+			Expect(helper_EndNames(&mock)).To(Equal([]string{"config.lock.read_wait", "config.lock.read_wait", "config.lock.wait", "config.lock.hold"}))
+		})
+	})
+	g.Describe("Channels", func() {
+		g.It("should gauge how full a channel is", func() {
+			jobs := make(chan int, 10)
+			jobs <- 1
+			jobs <- 2
+			Expect(helper_Collect(ChannelCollector(jobs))).To(Equal(map[string]float64{"len": 2, "cap": 10}))
+		})
+		g.It("should send gauges once registered", func() {
+			sock, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+			Expect(err).NotTo(HaveOccurred())
+			defer sock.Close()
+			os.Setenv("STATSD_ADDRESS", sock.LocalAddr().String())
+			os.Setenv("STATSD_PREFIX", "test")
+			clock := NewFakeClock(time.Now())
+			stats, err := CreateStatsdClientWithOptions(Options{Clock: clock, BufferFlushPeriod: time.Hour})
+			Expect(err).NotTo(HaveOccurred())
+			jobs := make(chan string, 4)
+			jobs <- "a"
+			Expect(stats.RegisterCollector("jobs.queue", ChannelCollector(jobs), time.Second)).NotTo(HaveOccurred())
+			clock.BlockUntil(2)
+			clock.Advance(time.Second)
+			Expect(helper_ReadUDP(sock)).To(Equal("test.jobs.queue.len:1|g"))
+			Expect(helper_ReadUDP(sock)).To(Equal("test.jobs.queue.cap:4|g"))
+		})
+		g.It("should only time sends that had to wait", func() {
+			mock := NewMock()
+			jobs := make(chan int, 1)
+			Send(&mock, "jobs.queue", jobs, 1)
+			Expect(mock.CallsToEnd).To(BeEmpty())
+			go func() {
+				time.Sleep(5 * time.Millisecond)
+				<-jobs
+			}()
+			Send(&mock, "jobs.queue", jobs, 2)
+			Expect(helper_EndNames(&mock)).To(Equal([]string{"jobs.queue.blocked"}))
+			Expect(time.Since(mock.CallsToEnd[0].Tim)).To(BeNumerically(">=", 4*time.Millisecond))
+			Expect(<-jobs).To(Equal(2))
+		})
+	})
+}
@@ -0,0 +1,102 @@
+package gstats
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+type contextKey int
+
+const (
+	statserKey contextKey = iota
+	tallyKey
+)
+
+// WithStatser returns a copy of ctx carrying s, for code too deep to be
+// handed a Statser of its own
+// > ctx = gstats.WithStatser(ctx, stats)
+// > gstats.FromContext(ctx).Inc("cache.miss")
+func WithStatser(ctx context.Context, s Statser) context.Context {
+	return context.WithValue(ctx, statserKey, s)
+}
+
+// FromContext returns the Statser added with WithStatser, or one that
+// sends nothing
+func FromContext(ctx context.Context) Statser {
+	if s, ok := ctx.Value(statserKey).(Statser); ok && s != nil {
+		return s
+	}
+	return NoopStatser{}
+}
+
+// RequestTally adds up what happened while serving one request, DB calls,
+// cache misses, bytes read, and sends every total once as a histogram
+// sample when the request is done, so the spread per request can be graphed
+// > ctx, tally := gstats.WithRequestTally(r.Context(), "db.calls")
+// > defer tally.Emit(stats, "checkout")
+// > ...
+// > gstats.Tally(ctx, "db.calls", 1) // anywhere below, checkout.db.calls is sent on Emit
+type RequestTally struct {
+	mu      sync.Mutex
+	totals  map[string]int64
+	emitted bool
+}
+
+// WithRequestTally returns a copy of ctx carrying a new RequestTally.
+// Declared stats are sent even when nothing was tallied for them, so
+// requests that made no DB calls count as zero instead of going missing.
+func WithRequestTally(ctx context.Context, declared ...string) (context.Context, *RequestTally) {
+	t := &RequestTally{totals: make(map[string]int64)}
+	for _, stat := range declared {
+		t.totals[stat] = 0
+	}
+	return context.WithValue(ctx, tallyKey, t), t
+}
+
+// Tally adds n to the request's total for stat, it does nothing when ctx has
+// no RequestTally
+func Tally(ctx context.Context, stat string, n int64) {
+	if t, ok := ctx.Value(tallyKey).(*RequestTally); ok {
+		t.Add(stat, n)
+	}
+}
+
+func (t *RequestTally) Add(stat string, n int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.totals[stat] += n
+}
+
+// the totals so far
+func (t *RequestTally) Totals() map[string]int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	totals := make(map[string]int64, len(t.totals))
+	for stat, total := range t.totals {
+		totals[stat] = total
+	}
+	return totals
+}
+
+// Emit sends every total as prefix.stat, only the first call sends anything
+func (t *RequestTally) Emit(s Statser, prefix string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.emitted {
+		return
+	}
+	t.emitted = true
+	stats := make([]string, 0, len(t.totals))
+	for stat := range t.totals {
+		stats = append(stats, stat)
+	}
+	sort.Strings(stats)
+	for _, stat := range stats {
+		name := stat
+		if prefix != "" {
+			name = prefix + "." + stat
+		}
+		histogramOn(s, name, t.totals[stat])
+	}
+}
@@ -0,0 +1,73 @@
+package gstats
+
+import (
+	"context"
+	"net"
+	"os"
+	"sync"
+	"testing"
+
+	. "github.com/franela/goblin"
+	. "github.com/onsi/gomega"
+)
+
+func TestContext(t *testing.T) {
+	g := Goblin(t)
+	RegisterFailHandler(func(m string, _ ...int) { g.Fail(m) })
+	g.Describe("Statser in a context", func() {
+		g.It("should hand back the Statser it was given", func() {
+			mock := NewMock()
+			ctx := WithStatser(context.Background(), &mock)
+			FromContext(ctx).Inc("deep.library.call")
+			Expect(len(mock.CallsToInc)).To(Equal(1))
+			Expect(mock.CallsToInc[0].IncVal).To(Equal("deep.library.call"))
+		})
+		g.It("should fall back to a Statser that sends nothing", func() {
+			stats := FromContext(context.Background())
+			Expect(stats).NotTo(BeNil())
+			Expect(stats.Inc("nowhere")).NotTo(HaveOccurred())
+			Expect(FromContext(WithStatser(context.Background(), nil))).NotTo(BeNil())
+		})
+	})
+	g.Describe("RequestTally", func() {
+		g.It("should add up tallies from anywhere below the request", func() {
+			ctx, tally := WithRequestTally(context.Background(), "db.calls", "cache.misses")
+			wg := sync.WaitGroup{}
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					Tally(ctx, "db.calls", 1)
+					Tally(ctx, "bytes.read", 512)
+				}()
+			}
+			wg.Wait()
+			Expect(tally.Totals()).To(Equal(map[string]int64{"db.calls": 10, "cache.misses": 0, "bytes.read": 5120}))
+
+			mock := NewMock()
+			tally.Emit(&mock, "checkout")
+			tally.Emit(&mock, "checkout")
+			Expect(mock.CallsToHistogram).To(Equal([]HistogramSignature{
+				{"checkout.bytes.read", 5120},
+				{"checkout.cache.misses", 0},
+				{"checkout.db.calls", 10},
+			}))
+		})
+		g.It("should ignore tallies outside a request", func() {
+			Tally(context.Background(), "db.calls", 1)
+		})
+		g.It("should send histogram samples as timers", func() {
+			sock, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+			Expect(err).NotTo(HaveOccurred())
+			defer sock.Close()
+			os.Setenv("STATSD_ADDRESS", sock.LocalAddr().String())
+			os.Setenv("STATSD_PREFIX", "test")
+			stats, err := CreateStatsdClient()
+			Expect(err).NotTo(HaveOccurred())
+			ctx, tally := WithRequestTally(WithStatser(context.Background(), stats))
+			Tally(ctx, "db.calls", 3)
+			tally.Emit(FromContext(ctx), "checkout")
+			Expect(helper_ReadUDP(sock)).To(Equal("test.checkout.db.calls:3|ms"))
+		})
+	})
+}
@@ -0,0 +1,102 @@
+package gstats
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// the package-level Statser behind gstats.Inc and friends, boxed because
+// atomic.Pointer needs one type whatever the Statser is
+type statserBox struct {
+	Statser
+	// made by Default rather than given to SetDefault, so ours to close
+	owned bool
+}
+
+var (
+	defaultStatser atomic.Pointer[statserBox]
+	defaultOnce    sync.Once
+)
+
+// SetDefault replaces the Statser the package-level functions use, it is
+// safe to call at any time. nil sends nothing. The Statser Default made from
+// the environment is closed when replaced, one given to SetDefault is left
+// for the caller to close.
+// > stats, _ := gstats.CreateStatsdClient()
+// > gstats.SetDefault(stats)
+// > gstats.Inc("AnEvent")
+func SetDefault(s Statser) {
+	if s == nil {
+		s = NoopStatser{}
+	}
+	replaced := defaultStatser.Swap(&statserBox{Statser: s})
+	if replaced == nil || !replaced.owned {
+		return
+	}
+	if closer, ok := replaced.Statser.(io.Closer); ok {
+		closer.Close()
+	}
+}
+
+// Default returns the Statser the package-level functions use. Until
+// SetDefault is called it is made from the environment on first use, or is a
+// NoopStatser when $STATSD_ADDRESS is not set or the client cannot be made.
+func Default() Statser {
+	if box := defaultStatser.Load(); box != nil {
+		return box.Statser
+	}
+	defaultOnce.Do(func() {
+		s, err := NewStatser(Options{FailSoft: true})
+		if err != nil {
+			s = NoopStatser{}
+		}
+		// a SetDefault that got here first wins
+		if !defaultStatser.CompareAndSwap(nil, &statserBox{Statser: s, owned: true}) {
+			if closer, ok := s.(io.Closer); ok {
+				closer.Close()
+			}
+		}
+	})
+	return defaultStatser.Load().Statser
+}
+
+// gstats.End(gstats.Trace("MyFunc")) is Default().End
+func End(stat string, timestamp time.Time, incrementBy int64) {
+	Default().End(stat, timestamp, incrementBy)
+}
+
+func BufferedEnd(stat string, timestamp time.Time, incrementBy int64) {
+	Default().BufferedEnd(stat, timestamp, incrementBy)
+}
+
+func Inc(stat string) error {
+	return Default().Inc(stat)
+}
+
+func IncErr(stat string, err error) error {
+	return Default().IncErr(stat, err)
+}
+
+func IncrementBy(stat string, incrementBy int64) error {
+	return Default().IncrementBy(stat, incrementBy)
+}
+
+func BufferedIncrementBy(stat string, incrementBy int64) error {
+	return Default().BufferedIncrementBy(stat, incrementBy)
+}
+
+func Gauge(stat string, value int64) error {
+	return Default().Gauge(stat, value)
+}
+
+// Default().Mark, or IncrementBy when the default Statser has no meters
+func Mark(stat string, n int64) {
+	markOn(Default(), stat, n)
+}
+
+// Default().Histogram, or End when the default Statser has no histograms
+func Histogram(stat string, value int64) error {
+	return histogramOn(Default(), stat, value)
+}
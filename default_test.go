@@ -0,0 +1,115 @@
+package gstats
+
+import (
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/franela/goblin"
+	. "github.com/onsi/gomega"
+)
+
+// forgets the default, as if the package had just been loaded
+func helper_ResetDefault() {
+	defaultStatser.Store(nil)
+	defaultOnce = sync.Once{}
+}
+
+func TestDefault(t *testing.T) {
+	g := Goblin(t)
+	RegisterFailHandler(func(m string, _ ...int) { g.Fail(m) })
+	g.Describe("Default Statser", func() {
+		var address string
+		g.BeforeEach(func() {
+			address = os.Getenv("STATSD_ADDRESS")
+			helper_ResetDefault()
+		})
+		g.AfterEach(func() {
+			os.Setenv("STATSD_ADDRESS", address)
+			helper_ResetDefault()
+		})
+		g.It("should send nothing when nothing is configured", func() {
+			os.Unsetenv("STATSD_ADDRESS")
+			Expect(Inc("early")).NotTo(HaveOccurred())
+			Expect(Default()).To(Equal(NoopStatser{}))
+		})
+		g.It("should make a client from the environment on first use", func() {
+			sock, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+			Expect(err).NotTo(HaveOccurred())
+			defer sock.Close()
+			os.Setenv("STATSD_ADDRESS", sock.LocalAddr().String())
+			os.Setenv("STATSD_PREFIX", "test")
+			Expect(Inc("lazy")).NotTo(HaveOccurred())
+			Expect(helper_ReadUDP(sock)).To(Equal("test.lazy.count:1|c"))
+			Expect(Default() == Default()).To(BeTrue())
+		})
+		g.It("should send every package-level call to the default", func() {
+			mock := NewMock()
+			SetDefault(&mock)
+			now := time.Now()
+			Inc("inc")
+			IncErr("incerr", errors.New("boom"))
+			IncResult(nil, "result", nil)
+			IncrementBy("by", 2)
+			BufferedIncrementBy("buffered", 3)
+			Gauge("gauge", 4)
+			End("end", now, 1)
+			BufferedEnd("bufferedend", now, 1)
+			Mark("mark", 5)
+			Histogram("histogram", 6)
+			Expect(mock.CallsToInc).To(Equal([]IncSignature{{"inc"}}))
+			Expect(len(mock.CallsToIncErr)).To(Equal(1))
+			Expect(len(mock.CallsToIncResult)).To(Equal(1))
+			Expect(mock.CallsToIncrementBy).To(Equal([]IncrementBySignature{{"by", 2}}))
+			Expect(mock.CallsToBufferedIncrementBy).To(Equal([]IncrementBySignature{{"buffered", 3}}))
+			Expect(mock.CallsToGauge).To(Equal([]GaugeSignature{{"gauge", 4}}))
+			Expect(mock.CallsToEnd).To(Equal([]EndSignature{{"end", now, 1}}))
+			Expect(mock.CallsToBufferedEnd).To(Equal([]EndSignature{{"bufferedend", now, 1}}))
+			Expect(mock.Marked("mark")).To(Equal(int64(5)))
+			Expect(mock.CallsToHistogram).To(Equal([]HistogramSignature{{"histogram", 6}}))
+		})
+		g.It("should close the client it made when replaced", func() {
+			sock, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+			Expect(err).NotTo(HaveOccurred())
+			defer sock.Close()
+			os.Setenv("STATSD_ADDRESS", sock.LocalAddr().String())
+			lazy := Default().(*Statistics)
+			SetDefault(nil)
+			Expect(lazy.done).To(BeClosed())
+		})
+		g.It("should leave closing a client it was given to the caller", func() {
+			sock, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+			Expect(err).NotTo(HaveOccurred())
+			defer sock.Close()
+			os.Setenv("STATSD_ADDRESS", sock.LocalAddr().String())
+			given, err := CreateStatsdClient()
+			Expect(err).NotTo(HaveOccurred())
+			defer given.Close()
+			SetDefault(given)
+			SetDefault(nil)
+			Expect(given.done).NotTo(BeClosed())
+		})
+		g.It("should be swappable while in use", func() {
+			first, second := NewMock(), NewMock()
+			SetDefault(&first)
+			wg := sync.WaitGroup{}
+			for i := 0; i < 4; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for j := 0; j < 100; j++ {
+						Inc("busy")
+					}
+				}()
+			}
+			SetDefault(&second)
+			wg.Wait()
+			Expect(len(first.CallsToInc) + len(second.CallsToInc)).To(Equal(400))
+			SetDefault(nil)
+			Expect(Default()).To(Equal(NoopStatser{}))
+		})
+	})
+}
@@ -0,0 +1,115 @@
+package gstats
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// trace IDs kept per stat
+	slowestPerStat = 10
+	// how long a slow trace is kept before newer, faster ones may replace it
+	slowestWindow = 5 * time.Minute
+)
+
+// Exemplar is one timed call and the trace it belongs to
+type Exemplar struct {
+	TraceID  string        `json:"trace_id"`
+	Duration time.Duration `json:"duration"`
+	At       time.Time     `json:"at"`
+}
+
+type traceParentKey struct{}
+
+// WithTraceParent returns a copy of ctx carrying the trace ID of a W3C
+// traceparent header, "00-<trace id>-<span id>-<flags>". Headers that do not
+// parse leave ctx as it is.
+// > ctx = gstats.WithTraceParent(r.Context(), r.Header.Get("traceparent"))
+func WithTraceParent(ctx context.Context, header string) context.Context {
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return ctx
+	}
+	traceID := strings.ToLower(parts[1])
+	if _, err := hex.DecodeString(traceID); err != nil || traceID == strings.Repeat("0", 32) {
+		return ctx
+	}
+	return context.WithValue(ctx, traceParentKey{}, traceID)
+}
+
+// TraceParentID returns the trace ID WithTraceParent added to ctx, or ""
+func TraceParentID(ctx context.Context) string {
+	traceID, _ := ctx.Value(traceParentKey{}).(string)
+	return traceID
+}
+
+// stats.EndContext(ctx, name, start, incrementBy) is End for calls that
+// belong to a trace. With Options.DogStatsD the timer carries the trace ID
+// as a "trace_id" tag, the slowest recent calls of every stat are kept for
+// Slowest and SlowestHandler, and every call is counted in the histograms
+// OpenMetricsHandler serves, with its trace as the bucket's exemplar.
+// TraceContext ends its timers here too.
+// > name, start, inc := stats.TraceAndIncrement("checkout")
+// > defer stats.EndContext(ctx, name, start, inc)
+func (s *Statistics) EndContext(ctx context.Context, traceIdentifier string, timestamp time.Time, incrementBy int64) {
+	traceID := s.traceID(ctx)
+	tags := ""
+	if traceID != "" && s.dogStatsD {
+		tags = "trace_id:" + traceID
+	}
+	now, elapsed := s._End(traceIdentifier, timestamp, incrementBy, s.IncrementBy, tags)
+	s.exemplarMu.Lock()
+	defer s.exemplarMu.Unlock()
+	e := Exemplar{traceID, elapsed, now}
+	s.observe(traceIdentifier, e)
+	if traceID != "" {
+		s.keepSlowest(traceIdentifier, e)
+	}
+}
+
+// callers must hold s.exemplarMu
+func (s *Statistics) keepSlowest(stat string, e Exemplar) {
+	kept := s.slowest[stat][:0]
+	for _, old := range s.slowest[stat] {
+		if e.At.Sub(old.At) < slowestWindow {
+			kept = append(kept, old)
+		}
+	}
+	kept = append(kept, e)
+	sort.SliceStable(kept, func(i, j int) bool { return kept[i].Duration > kept[j].Duration })
+	if len(kept) > slowestPerStat {
+		kept = kept[:slowestPerStat]
+	}
+	s.slowest[stat] = kept
+}
+
+// Slowest returns the slowest calls of the last few minutes, slowest first,
+// for every stat timed with EndContext
+func (s *Statistics) Slowest() map[string][]Exemplar {
+	s.exemplarMu.Lock()
+	defer s.exemplarMu.Unlock()
+	now := s.clock.Now()
+	slowest := make(map[string][]Exemplar, len(s.slowest))
+	for stat, exemplars := range s.slowest {
+		for _, e := range exemplars {
+			if now.Sub(e.At) < slowestWindow {
+				slowest[stat] = append(slowest[stat], e)
+			}
+		}
+	}
+	return slowest
+}
+
+// SlowestHandler serves Slowest as JSON, for mounting on a debug mux
+// > http.Handle("/debug/gstats/slowest", stats.SlowestHandler())
+func (s *Statistics) SlowestHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(s.Slowest())
+	})
+}
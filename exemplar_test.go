@@ -0,0 +1,136 @@
+package gstats
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	. "github.com/franela/goblin"
+	. "github.com/onsi/gomega"
+)
+
+const helper_TraceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+// a valid 32 digit trace ID ending in id
+func helper_TraceID(id string) string {
+	return "4bf92f3577b34da6a3ce929d0e0e4736"[:32-len(id)] + id
+}
+
+func TestExemplars(t *testing.T) {
+	g := Goblin(t)
+	RegisterFailHandler(func(m string, _ ...int) { g.Fail(m) })
+	g.Describe("traceparent", func() {
+		g.It("should carry the trace ID of a valid header", func() {
+			ctx := WithTraceParent(context.Background(), helper_TraceParent)
+			Expect(TraceParentID(ctx)).To(Equal("4bf92f3577b34da6a3ce929d0e0e4736"))
+		})
+		g.It("should ignore headers that do not parse", func() {
+			for _, header := range []string{
+				"",
+				"garbage",
+				"00-4bf92f3577b34da6a3ce929d0e0e473-00f067aa0ba902b7-01",
+				"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+				"00-4bf92f3577b34da6a3ce929d0e0e47zz-00f067aa0ba902b7-01",
+				"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			} {
+				Expect(TraceParentID(WithTraceParent(context.Background(), header))).To(Equal(""))
+			}
+		})
+	})
+	g.Describe("EndContext", func() {
+		var sock *net.UDPConn
+		var clock *FakeClock
+		g.BeforeEach(func() {
+			var err error
+			sock, err = net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+			Expect(err).NotTo(HaveOccurred())
+			os.Setenv("STATSD_ADDRESS", sock.LocalAddr().String())
+			os.Setenv("STATSD_PREFIX", "test")
+			clock = NewFakeClock(time.Now())
+		})
+		g.AfterEach(func() {
+			sock.Close()
+		})
+		g.It("should tag timers with the trace ID for DogStatsD", func() {
+			stats, err := CreateStatsdClientWithOptions(Options{Clock: clock, BufferFlushPeriod: time.Hour, DogStatsD: true})
+			Expect(err).NotTo(HaveOccurred())
+			ctx := WithTraceParent(context.Background(), helper_TraceParent)
+			name, start, inc := stats.TraceAndIncrement("checkout")
+			clock.Advance(12 * time.Millisecond)
+			stats.EndContext(ctx, name, start, inc)
+			Expect(helper_ReadUDP(sock)).To(Equal("test.checkout.count:1|c"))
+			Expect(helper_ReadUDP(sock)).To(Equal("test.checkout:12|ms|#trace_id:4bf92f3577b34da6a3ce929d0e0e4736"))
+		})
+		g.It("should send plain timers to plain statsd", func() {
+			stats, err := CreateStatsdClientWithOptions(Options{Clock: clock, BufferFlushPeriod: time.Hour})
+			Expect(err).NotTo(HaveOccurred())
+			ctx := WithTraceParent(context.Background(), helper_TraceParent)
+			name, start, inc := stats.Trace("checkout")
+			clock.Advance(12 * time.Millisecond)
+			stats.EndContext(ctx, name, start, inc)
+			Expect(helper_ReadUDP(sock)).To(Equal("test.checkout:12|ms"))
+			Expect(stats.Slowest()["checkout"]).To(HaveLen(1))
+		})
+		g.It("should find trace IDs the way it is told to", func() {
+			otel := func(ctx context.Context) string { return "otel-trace" }
+			stats, err := CreateStatsdClientWithOptions(Options{Clock: clock, BufferFlushPeriod: time.Hour, DogStatsD: true, TraceID: otel})
+			Expect(err).NotTo(HaveOccurred())
+			name, start, inc := stats.Trace("checkout")
+			stats.EndContext(context.Background(), name, start, inc)
+			Expect(helper_ReadUDP(sock)).To(Equal("test.checkout:0|ms|#trace_id:otel-trace"))
+		})
+		g.It("should time like End without a trace", func() {
+			stats, err := CreateStatsdClientWithOptions(Options{Clock: clock, BufferFlushPeriod: time.Hour, DogStatsD: true})
+			Expect(err).NotTo(HaveOccurred())
+			name, start, inc := stats.Trace("checkout")
+			stats.EndContext(context.Background(), name, start, inc)
+			Expect(helper_ReadUDP(sock)).To(Equal("test.checkout:0|ms"))
+			Expect(stats.Slowest()).To(BeEmpty())
+		})
+		g.It("should apply rules to tagged timers", func() {
+			stats, err := CreateStatsdClientWithOptions(Options{Clock: clock, BufferFlushPeriod: time.Hour, DogStatsD: true})
+			Expect(err).NotTo(HaveOccurred())
+			stats.SetRules(helper_ParseRules("rename legacy.* api.*\ndeny debug.*"))
+			ctx := WithTraceParent(context.Background(), helper_TraceParent)
+			for _, stat := range []string{"debug.thing", "legacy.checkout"} {
+				name, start, inc := stats.Trace(stat)
+				stats.EndContext(ctx, name, start, inc)
+			}
+			Expect(helper_ReadUDP(sock)).To(Equal("test.api.checkout:0|ms|#trace_id:4bf92f3577b34da6a3ce929d0e0e4736"))
+		})
+		g.It("should keep the slowest recent traces of every stat", func() {
+			stats, err := CreateStatsdClientWithOptions(Options{Clock: clock, BufferFlushPeriod: time.Hour})
+			Expect(err).NotTo(HaveOccurred())
+			stats.SetRules(helper_ParseRules("deny *"))
+			for i := 1; i <= 15; i++ {
+				traceID := strconv.Itoa(i)
+				name, start, inc := stats.Trace("checkout")
+				clock.Advance(time.Duration(i%8) * time.Millisecond)
+				stats.EndContext(WithTraceParent(context.Background(), "00-"+helper_TraceID(traceID)+"-00f067aa0ba902b7-01"), name, start, inc)
+			}
+			slowest := stats.Slowest()["checkout"]
+			Expect(slowest).To(HaveLen(slowestPerStat))
+			Expect(slowest[0].Duration).To(Equal(7 * time.Millisecond))
+			Expect(slowest[0].TraceID).To(Equal(helper_TraceID("7")))
+			Expect(slowest[slowestPerStat-1].Duration).To(Equal(3 * time.Millisecond))
+
+			// old slow traces make way for new ones
+			clock.Advance(slowestWindow)
+			Expect(stats.Slowest()).To(BeEmpty())
+			name, start, inc := stats.Trace("checkout")
+			stats.EndContext(WithTraceParent(context.Background(), helper_TraceParent), name, start, inc)
+			Expect(stats.Slowest()["checkout"]).To(HaveLen(1))
+
+			recorder := httptest.NewRecorder()
+			stats.SlowestHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/debug/gstats/slowest", nil))
+			served := map[string][]Exemplar{}
+			Expect(json.Unmarshal(recorder.Body.Bytes(), &served)).NotTo(HaveOccurred())
+			Expect(served["checkout"][0].TraceID).To(Equal("4bf92f3577b34da6a3ce929d0e0e4736"))
+		})
+	})
+}
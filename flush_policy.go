@@ -0,0 +1,114 @@
+package gstats
+
+import (
+	"path"
+	"time"
+)
+
+const defaultBufferIdleTimeout = 5 * time.Minute
+
+// FlushPolicy decides when a buffered counter is sent to statsd. A zero Count
+// disables the count threshold, a zero MaxAge leaves the stat to be sent on
+// every tick of the flush loop.
+type FlushPolicy struct {
+	// send the stat as soon as the absolute value of its buffered total
+	// reaches Count
+	Count int64
+	// send the stat once its oldest unsent increment is MaxAge old. This is
+	// checked on every increment and on every tick of the flush loop, so a
+	// MaxAge longer than BufferFlushPeriod holds the stat back for longer.
+	MaxAge time.Duration
+}
+
+// the policy applied to stats that do not match any registered pattern
+var DefaultFlushPolicy = FlushPolicy{Count: 100}
+
+type flushRule struct {
+	pattern string
+	policy  FlushPolicy
+}
+
+// bookkeeping for a single entry of IncrementBuffers
+type bufferAge struct {
+	// when the oldest unsent increment arrived, zero if nothing is pending
+	first time.Time
+	// when the stat was last incremented, used to evict idle entries
+	last time.Time
+}
+
+// stats.SetFlushPolicy("db.*.queries", gstats.FlushPolicy{Count: 1000, MaxAge: 5 * time.Second})
+// patterns use path.Match syntax and the first registered match wins
+func (s *Statistics) SetFlushPolicy(pattern string, policy FlushPolicy) error {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return err
+	}
+	s.mu <- true
+	defer func() { <-s.mu }()
+	for i, rule := range s.flushRules {
+		if rule.pattern == pattern {
+			s.flushRules[i].policy = policy
+			return nil
+		}
+	}
+	s.flushRules = append(s.flushRules, flushRule{pattern, policy})
+	return nil
+}
+
+// callers must hold s.mu
+func (s *Statistics) flushPolicy(stat string) FlushPolicy {
+	for _, rule := range s.flushRules {
+		if matched, _ := path.Match(rule.pattern, stat); matched {
+			return rule.policy
+		}
+	}
+	return DefaultFlushPolicy
+}
+
+// callers must hold s.mu
+func (s *Statistics) dueForFlush(stat string, now time.Time, tick bool) bool {
+	total := s.IncrementBuffers[stat]
+	if total == 0 {
+		return false
+	}
+	policy := s.flushPolicy(stat)
+	if policy.Count > 0 && abs(total) >= policy.Count {
+		return true
+	}
+	if policy.MaxAge > 0 {
+		return now.Sub(s.bufferAges[stat].first) >= policy.MaxAge
+	}
+	return tick
+}
+
+// callers must hold s.mu
+func (s *Statistics) flushStat(stat string) error {
+	total := s.IncrementBuffers[stat]
+	s.IncrementBuffers[stat] = 0
+	age := s.bufferAges[stat]
+	age.first = time.Time{}
+	s.bufferAges[stat] = age
+	if total == 0 {
+		return nil
+	}
+	return s.client.Inc(stat, total, 1.0)
+}
+
+// callers must hold s.mu
+func (s *Statistics) evictIdleBuffers(now time.Time) {
+	if s.BufferIdleTimeout <= 0 {
+		return
+	}
+	for stat, total := range s.IncrementBuffers {
+		if total == 0 && now.Sub(s.bufferAges[stat].last) >= s.BufferIdleTimeout {
+			delete(s.IncrementBuffers, stat)
+			delete(s.bufferAges, stat)
+		}
+	}
+}
+
+func abs(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,138 @@
+package gstats
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// buffers the wire lines handles build, so sending does not allocate
+var linePool = sync.Pool{New: func() interface{} {
+	line := make([]byte, 0, 128)
+	return &line
+}}
+
+// a stat whose wire prefix, "prefix.stat:", is worked out once instead of on
+// every send. Rules are applied when the handle is first used and again only
+// after they change.
+type boundStat struct {
+	s       *Statistics
+	stat    string
+	suffix  string
+	binding atomic.Pointer[statBinding]
+}
+
+type statBinding struct {
+	// ruleSender.version the binding was made under
+	version uint64
+	// the stat after rules, used for routing
+	stat string
+	line []byte
+	// false when the rules drop the stat
+	send bool
+}
+
+func (b *boundStat) bind(version uint64) *statBinding {
+	stat, send := b.s.filter.apply(b.stat)
+	line := []byte{}
+	if b.s.prefix != "" {
+		line = append(line, b.s.prefix...)
+		line = append(line, '.')
+	}
+	line = append(line, stat...)
+	line = append(line, ':')
+	binding := &statBinding{version, stat, line, send}
+	b.binding.Store(binding)
+	return binding
+}
+
+func (b *boundStat) send(value int64) error {
+	version := b.s.filter.version.Load()
+	binding := b.binding.Load()
+	if binding == nil || binding.version != version {
+		binding = b.bind(version)
+	}
+	if !binding.send {
+		return nil
+	}
+	buf := linePool.Get().(*[]byte)
+	line := append((*buf)[:0], binding.line...)
+	line = strconv.AppendInt(line, value, 10)
+	line = append(line, b.suffix...)
+	err := b.s.client.write(binding.stat, line)
+	*buf = line
+	linePool.Put(buf)
+	return err
+}
+
+// CounterHandle is a counter bound to one stat name
+// > requests := stats.Counter("requests")
+// > requests.Inc() // same as stats.Inc("requests"), without allocating
+type CounterHandle struct {
+	count boundStat
+	raw   boundStat
+}
+
+func (s *Statistics) Counter(stat string) *CounterHandle {
+	return &CounterHandle{
+		count: boundStat{s: s, stat: stat + ".count", suffix: "|c"},
+		raw:   boundStat{s: s, stat: stat, suffix: "|c"},
+	}
+}
+
+// same as stats.Inc(stat)
+func (c *CounterHandle) Inc() error {
+	return c.count.send(1)
+}
+
+// same as stats.IncrementBy(stat, incrementBy)
+func (c *CounterHandle) IncrementBy(incrementBy int64) error {
+	return c.raw.send(incrementBy)
+}
+
+// GaugeHandle is a gauge bound to one stat name
+// > queue := stats.GaugeHandle("queue.length")
+// > queue.Set(len(jobs)) // same as stats.Gauge("queue.length", len(jobs))
+type GaugeHandle struct {
+	bound boundStat
+}
+
+func (s *Statistics) GaugeHandle(stat string) *GaugeHandle {
+	return &GaugeHandle{boundStat{s: s, stat: stat, suffix: "|g"}}
+}
+
+// same as stats.Gauge(stat, value)
+func (g *GaugeHandle) Set(value int64) error {
+	return g.bound.send(value)
+}
+
+// TimerHandle is a timer bound to one stat name
+// > query := stats.Timer("db.query")
+// > defer query.End(query.Start())
+type TimerHandle struct {
+	bound boundStat
+}
+
+func (s *Statistics) Timer(stat string) *TimerHandle {
+	return &TimerHandle{boundStat{s: s, stat: stat, suffix: "|ms"}}
+}
+
+// the current time on the client's Clock
+func (t *TimerHandle) Start() time.Time {
+	return t.bound.s.clock.Now()
+}
+
+// records the milliseconds since start, like stats.End(stat, start, 0)
+func (t *TimerHandle) End(start time.Time) error {
+	return t.Record(t.bound.s.clock.Now().Sub(start))
+}
+
+// records a duration measured elsewhere. Sketch policies apply as they do to
+// stats.End.
+func (t *TimerHandle) Record(duration time.Duration) error {
+	if !t.bound.s.sketchSample(t.bound.stat, float64(duration)/float64(time.Millisecond)) {
+		return nil
+	}
+	return t.bound.send(int64(duration / time.Millisecond))
+}
@@ -0,0 +1,142 @@
+package gstats
+
+import (
+	"errors"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	. "github.com/franela/goblin"
+	. "github.com/onsi/gomega"
+)
+
+func helper_BenchmarkClient(b *testing.B) (*Statistics, *net.UDPConn) {
+	sock, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		b.Fatal(err)
+	}
+	stats, err := CreateStatsdClientWithOptions(Options{Address: sock.LocalAddr().String(), Prefix: "bench"})
+	if err != nil {
+		b.Fatal(err)
+	}
+	return stats, sock
+}
+
+func TestHandles(t *testing.T) {
+	g := Goblin(t)
+	RegisterFailHandler(func(m string, _ ...int) { g.Fail(m) })
+	g.Describe("Handles", func() {
+		var sock *net.UDPConn
+		var stats *Statistics
+		var clock *FakeClock
+		g.BeforeEach(func() {
+			var err error
+			sock, err = net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+			Expect(err).NotTo(HaveOccurred())
+			os.Setenv("STATSD_ADDRESS", sock.LocalAddr().String())
+			os.Setenv("STATSD_PREFIX", "test")
+			clock = NewFakeClock(time.Now())
+			stats, err = CreateStatsdClientWithOptions(Options{Clock: clock})
+			Expect(err).NotTo(HaveOccurred())
+		})
+		g.AfterEach(func() {
+			sock.Close()
+		})
+		g.It("should send what the unbound methods send", func() {
+			requests := stats.Counter("requests")
+			Expect(requests.Inc()).NotTo(HaveOccurred())
+			Expect(helper_ReadUDP(sock)).To(Equal("test.requests.count:1|c"))
+			Expect(requests.IncrementBy(-5)).NotTo(HaveOccurred())
+			Expect(helper_ReadUDP(sock)).To(Equal("test.requests:-5|c"))
+
+			Expect(stats.GaugeHandle("queue").Set(12)).NotTo(HaveOccurred())
+			Expect(helper_ReadUDP(sock)).To(Equal("test.queue:12|g"))
+
+			query := stats.Timer("db.query")
+			start := query.Start()
+			clock.Advance(25 * time.Millisecond)
+			Expect(query.End(start)).NotTo(HaveOccurred())
+			Expect(helper_ReadUDP(sock)).To(Equal("test.db.query:25|ms"))
+			Expect(query.Record(3 * time.Second)).NotTo(HaveOccurred())
+			Expect(helper_ReadUDP(sock)).To(Equal("test.db.query:3000|ms"))
+		})
+		g.It("should follow rules, even when they change after binding", func() {
+			requests := stats.Counter("legacy.requests")
+			Expect(requests.Inc()).NotTo(HaveOccurred())
+			Expect(helper_ReadUDP(sock)).To(Equal("test.legacy.requests.count:1|c"))
+
+			stats.SetRules(helper_ParseRules("rename legacy.* modern.*"))
+			Expect(requests.Inc()).NotTo(HaveOccurred())
+			Expect(helper_ReadUDP(sock)).To(Equal("test.modern.requests.count:1|c"))
+
+			Expect(stats.DropFamily("legacy.*")).NotTo(HaveOccurred())
+			Expect(requests.Inc()).NotTo(HaveOccurred())
+			Expect(stats.GaugeHandle("other").Set(1)).NotTo(HaveOccurred())
+			Expect(helper_ReadUDP(sock)).To(Equal("test.other:1|g"))
+		})
+		g.It("should not allocate", func() {
+			if raceEnabled {
+				return
+			}
+			requests := stats.Counter("requests")
+			queue := stats.GaugeHandle("queue")
+			query := stats.Timer("db.query")
+			allocs := testing.AllocsPerRun(100, func() {
+				requests.Inc()
+				requests.IncrementBy(3)
+				queue.Set(7)
+				query.Record(time.Millisecond)
+			})
+			Expect(allocs).To(BeNumerically("==", 0))
+		})
+	})
+}
+
+func BenchmarkInc(b *testing.B) {
+	stats, sock := helper_BenchmarkClient(b)
+	defer sock.Close()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		stats.Inc("requests")
+	}
+}
+
+func BenchmarkCounterInc(b *testing.B) {
+	stats, sock := helper_BenchmarkClient(b)
+	defer sock.Close()
+	requests := stats.Counter("requests")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		requests.Inc()
+	}
+}
+
+func BenchmarkIncErr(b *testing.B) {
+	stats, sock := helper_BenchmarkClient(b)
+	defer sock.Close()
+	err := errors.New("not found")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		stats.IncErr("lookups", err)
+	}
+}
+
+func BenchmarkGauge(b *testing.B) {
+	stats, sock := helper_BenchmarkClient(b)
+	defer sock.Close()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		stats.Gauge("queue", int64(i))
+	}
+}
+
+func BenchmarkGaugeHandleSet(b *testing.B) {
+	stats, sock := helper_BenchmarkClient(b)
+	defer sock.Close()
+	queue := stats.GaugeHandle("queue")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		queue.Set(int64(i))
+	}
+}
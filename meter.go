@@ -0,0 +1,118 @@
+package gstats
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// windows of the moving averages, as in the load averages top shows
+var meterWindows = [3]time.Duration{time.Minute, 5 * time.Minute, 15 * time.Minute}
+
+// Meter measures how often something happens. Every flush it sends, as
+// gauges in events per minute rounded to the nearest whole event, so meters
+// slower than one event a second still show up. The unit is in the names:
+//
+//	stat.mean_rate_per_min  since the meter was created
+//	stat.m1_rate_per_min    exponentially weighted over the last minute
+//	stat.m5_rate_per_min    ... 5 minutes
+//	stat.m15_rate_per_min   ... 15 minutes
+//
+// > requests := stats.Meter("requests")
+// > requests.Mark(1)
+type Meter struct {
+	stat string
+	// marks since the last tick
+	pending atomic.Int64
+	// guards the rest, which only flushes touch
+	mu       sync.Mutex
+	total    int64
+	created  time.Time
+	lastTick time.Time
+	ticked   bool
+	rates    [3]float64 // events per second
+}
+
+// stats.Meter(stat) returns the same Meter every time it is called with the
+// same stat, looking it up takes no lock once it exists
+func (s *Statistics) Meter(stat string) *Meter {
+	if m, ok := s.meters.Load(stat); ok {
+		return m.(*Meter)
+	}
+	now := s.clock.Now()
+	m, _ := s.meters.LoadOrStore(stat, &Meter{stat: stat, created: now, lastTick: now})
+	return m.(*Meter)
+}
+
+// records n events, nothing is sent until the next flush
+func (m *Meter) Mark(n int64) {
+	m.pending.Add(n)
+}
+
+// stats.Mark("requests", 1) is stats.Meter("requests").Mark(1)
+func (s *Statistics) Mark(stat string, n int64) {
+	s.Meter(stat).Mark(n)
+}
+
+// marks a meter if s has them, counts n otherwise
+func markOn(s Statser, stat string, n int64) {
+	if m, ok := s.(MeterStatser); ok {
+		m.Mark(stat, n)
+		return
+	}
+	s.IncrementBy(stat, n)
+}
+
+// folds the marks since the last tick into the averages. The weight of the
+// new rate depends on how long ago the last tick was, so a Flush between two
+// ticks of the flush loop does not skew the averages. Callers must hold m.mu.
+func (m *Meter) tick(now time.Time) {
+	elapsed := now.Sub(m.lastTick)
+	if elapsed <= 0 {
+		return
+	}
+	marks := m.pending.Swap(0)
+	m.total += marks
+	rate := float64(marks) / elapsed.Seconds()
+	for i, window := range meterWindows {
+		if !m.ticked {
+			m.rates[i] = rate
+			continue
+		}
+		alpha := 1 - math.Exp(-float64(elapsed)/float64(window))
+		m.rates[i] += alpha * (rate - m.rates[i])
+	}
+	m.ticked = true
+	m.lastTick = now
+}
+
+func (m *Meter) meanRate(now time.Time) float64 {
+	elapsed := now.Sub(m.created)
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(m.total) / elapsed.Seconds()
+}
+
+func (s *Statistics) flushMeters(now time.Time) {
+	s.meters.Range(func(_, value interface{}) bool {
+		m := value.(*Meter)
+		m.mu.Lock()
+		m.tick(now)
+		ticked := m.ticked
+		rates := [4]float64{m.meanRate(now), m.rates[0], m.rates[1], m.rates[2]}
+		m.mu.Unlock()
+		if !ticked {
+			return true
+		}
+		for i, name := range []string{".mean_rate_per_min", ".m1_rate_per_min", ".m5_rate_per_min", ".m15_rate_per_min"} {
+			s.client.Gauge(m.stat+name, perMinute(rates[i]), 1.0)
+		}
+		return true
+	})
+}
+
+func perMinute(perSecond float64) int64 {
+	return int64(math.Round(perSecond * 60))
+}
@@ -0,0 +1,111 @@
+package gstats
+
+import (
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	. "github.com/franela/goblin"
+	. "github.com/onsi/gomega"
+)
+
+func helper_ReadMeter(sock *net.UDPConn) []string {
+	lines := []string{}
+	for i := 0; i < 4; i++ {
+		lines = append(lines, helper_ReadUDP(sock))
+	}
+	return lines
+}
+
+func TestMeter(t *testing.T) {
+	g := Goblin(t)
+	RegisterFailHandler(func(m string, _ ...int) { g.Fail(m) })
+	g.Describe("Meter", func() {
+		var sock *net.UDPConn
+		var stats *Statistics
+		var clock *FakeClock
+		g.BeforeEach(func() {
+			var err error
+			sock, err = net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+			Expect(err).NotTo(HaveOccurred())
+			os.Setenv("STATSD_ADDRESS", sock.LocalAddr().String())
+			os.Setenv("STATSD_PREFIX", "test")
+			clock = NewFakeClock(time.Now())
+			stats, err = CreateStatsdClientWithOptions(Options{Clock: clock, BufferFlushPeriod: time.Hour})
+			Expect(err).NotTo(HaveOccurred())
+		})
+		g.AfterEach(func() {
+			sock.Close()
+		})
+		g.It("should hand out the same meter for the same stat", func() {
+			Expect(stats.Meter("requests") == stats.Meter("requests")).To(BeTrue())
+			Expect(stats.Meter("requests") == stats.Meter("errors")).To(BeFalse())
+		})
+		g.It("should start every average at the first interval's rate", func() {
+			stats.Meter("requests").Mark(50)
+			stats.Mark("requests", 50)
+			clock.Advance(10 * time.Second)
+			stats.Flush()
+			Expect(helper_ReadMeter(sock)).To(Equal([]string{
+				"test.requests.mean_rate_per_min:600|g",
+				"test.requests.m1_rate_per_min:600|g",
+				"test.requests.m5_rate_per_min:600|g",
+				"test.requests.m15_rate_per_min:600|g",
+			}))
+		})
+		g.It("should let the short averages decay faster than the long ones", func() {
+			meter := stats.Meter("requests")
+			meter.Mark(6000)
+			clock.Advance(time.Minute)
+			stats.Flush()
+			helper_ReadMeter(sock)
+			clock.Advance(time.Minute)
+			stats.Flush()
+			// a minute without marks weighs 1-e^-1 in the 1 minute average,
+			// 1-e^-1/5 in the 5 minute one and 1-e^-1/15 in the 15 minute one
+			Expect(helper_ReadMeter(sock)).To(Equal([]string{
+				"test.requests.mean_rate_per_min:3000|g",
+				"test.requests.m1_rate_per_min:2207|g",
+				"test.requests.m5_rate_per_min:4912|g",
+				"test.requests.m15_rate_per_min:5613|g",
+			}))
+		})
+		g.It("should weigh a flush by how long it has been since the last one", func() {
+			meter := stats.Meter("requests")
+			meter.Mark(60)
+			clock.Advance(time.Second)
+			stats.Flush()
+			helper_ReadMeter(sock)
+			// the same idle minute, split over many flushes
+			for i := 0; i < 60; i++ {
+				clock.Advance(time.Second)
+				stats.Flush()
+				helper_ReadMeter(sock)
+			}
+			Expect(meter.rates[0]).To(BeNumerically("~", 60*0.3679, 0.01))
+		})
+		g.It("should not round meters slower than one event a second away", func() {
+			stats.Mark("retries", 1)
+			clock.Advance(10 * time.Second)
+			stats.Flush()
+			Expect(helper_ReadMeter(sock)).To(Equal([]string{
+				"test.retries.mean_rate_per_min:6|g",
+				"test.retries.m1_rate_per_min:6|g",
+				"test.retries.m5_rate_per_min:6|g",
+				"test.retries.m15_rate_per_min:6|g",
+			}))
+		})
+		g.It("should keep sending rates while nothing is marked", func() {
+			stats.Meter("requests")
+			clock.Advance(time.Second)
+			stats.Flush()
+			Expect(helper_ReadMeter(sock)).To(Equal([]string{
+				"test.requests.mean_rate_per_min:0|g",
+				"test.requests.m1_rate_per_min:0|g",
+				"test.requests.m5_rate_per_min:0|g",
+				"test.requests.m15_rate_per_min:0|g",
+			}))
+		})
+	})
+}
@@ -28,6 +28,14 @@ type IncErrSignature struct {
 	Err    error
 }
 
+// Outcomes holds what Statistics.IncResult would have counted, "success" for
+// a nil error or the normalized name of every distinct joined error
+type IncResultSignature struct {
+	IncVal   string
+	Err      error
+	Outcomes []string
+}
+
 type EndSignature struct {
 	Str string
 	Tim time.Time
@@ -44,25 +52,36 @@ type GaugeSignature struct {
 	Num int64
 }
 
+type HistogramSignature struct {
+	Str string
+	Num int64
+}
+
 type MockStatser struct {
 	CallsToInc                 []IncSignature
 	CallsToIncErr              []IncErrSignature
+	CallsToIncResult           []IncResultSignature
 	CallsToEnd                 []EndSignature
 	CallsToBufferedEnd         []EndSignature
 	CallsToIncrementBy         []IncrementBySignature
 	CallsToBufferedIncrementBy []IncrementBySignature
 	CallsToGauge               []GaugeSignature
+	CallsToMark                []IncrementBySignature
+	CallsToHistogram           []HistogramSignature
 }
 
 func NewMock() MockStatser {
 	m := MockStatser{
 		CallsToInc:                 []IncSignature{},
 		CallsToIncErr:              []IncErrSignature{},
+		CallsToIncResult:           []IncResultSignature{},
 		CallsToEnd:                 []EndSignature{},
 		CallsToBufferedEnd:         []EndSignature{},
 		CallsToIncrementBy:         []IncrementBySignature{},
 		CallsToBufferedIncrementBy: []IncrementBySignature{},
 		CallsToGauge:               []GaugeSignature{},
+		CallsToMark:                []IncrementBySignature{},
+		CallsToHistogram:           []HistogramSignature{},
 	}
 	return m
 }
@@ -81,6 +100,13 @@ func (t *MockStatser) IncErr(incVal string, err error) error {
 	return nil
 }
 
+func (t *MockStatser) IncResult(incVal string, err error) error {
+	mu.Lock()
+	defer func() { mu.Unlock() }()
+	t.CallsToIncResult = append(t.CallsToIncResult, IncResultSignature{incVal, err, outcomes(err, DefaultNormalizer)})
+	return nil
+}
+
 func (t *MockStatser) End(str string, tim time.Time, num int64) {
 	mu.Lock()
 	defer func() { mu.Unlock() }()
@@ -119,3 +145,97 @@ func (t *MockStatser) Gauge(str string, num int64) error {
 	t.CallsToGauge = append(t.CallsToGauge, GaugeSignature{str, num})
 	return nil
 }
+
+func (t *MockStatser) Mark(str string, num int64) {
+	mu.Lock()
+	defer func() { mu.Unlock() }()
+	t.CallsToMark = append(t.CallsToMark, IncrementBySignature{str, num})
+}
+
+// Marked is the total of every Mark for the stat
+func (t *MockStatser) Marked(str string) int64 {
+	mu.Lock()
+	defer func() { mu.Unlock() }()
+	total := int64(0)
+	for _, call := range t.CallsToMark {
+		if call.Str == str {
+			total += call.Num
+		}
+	}
+	return total
+}
+
+func (t *MockStatser) Histogram(str string, num int64) error {
+	mu.Lock()
+	defer func() { mu.Unlock() }()
+	t.CallsToHistogram = append(t.CallsToHistogram, HistogramSignature{str, num})
+	return nil
+}
+
+// FakeClock is a Clock that only moves when told to
+// > clock := gstats.NewFakeClock(time.Now())
+// > stats, _ := gstats.CreateStatsdClientWithOptions(gstats.Options{Clock: clock})
+// > clock.BlockUntil(1) // the flush loop is waiting
+// > clock.Advance(time.Second) // and now it flushes
+type FakeClock struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	now     time.Time
+	waiters []fakeWaiter
+}
+
+type fakeWaiter struct {
+	deadline time.Time
+	ch       chan time.Time
+}
+
+func NewFakeClock(now time.Time) *FakeClock {
+	c := &FakeClock{now: now}
+	c.cond = sync.NewCond(&c.mu)
+	return c
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *FakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+	c.waiters = append(c.waiters, fakeWaiter{c.now.Add(d), ch})
+	c.cond.Broadcast()
+	return ch
+}
+
+// Advance moves the clock forward and fires every After that has come due
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	waiting := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.deadline.After(c.now) {
+			waiting = append(waiting, w)
+		} else {
+			w.ch <- c.now
+		}
+	}
+	c.waiters = waiting
+}
+
+// BlockUntil waits until n calls to After are waiting on the clock, so an
+// Advance is not missed by a goroutine that has not got to its After yet
+func (c *FakeClock) BlockUntil(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.waiters) < n {
+		c.cond.Wait()
+	}
+}
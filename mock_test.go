@@ -31,6 +31,18 @@ func TestMocks(t *testing.T) {
 			Expect(mock.CallsToIncErr[0].IncVal).To(Equal("incing error"))
 			Expect(mock.CallsToIncErr[0].Err).To(Equal(incErr))
 		})
+		g.It("should record calls to IncResult with their outcomes", func() {
+			results := stats.(ResultStatser)
+			results.IncResult("op", nil)
+			failure := errors.Join(errors.New("timeout"), errors.New("not found"))
+			results.IncResult("op", failure)
+			Expect(len(mock.CallsToIncResult)).To(Equal(2))
+			Expect(mock.CallsToIncResult[0].IncVal).To(Equal("op"))
+			Expect(mock.CallsToIncResult[0].Err).To(BeNil())
+			Expect(mock.CallsToIncResult[0].Outcomes).To(Equal([]string{"success"}))
+			Expect(mock.CallsToIncResult[1].Err).To(Equal(failure))
+			Expect(mock.CallsToIncResult[1].Outcomes).To(Equal([]string{"Timeout", "NotFound"}))
+		})
 		g.It("should record calls to End", func() {
 			endTime := time.Now()
 			stats.End("calling end", endTime, 5)
@@ -65,5 +77,47 @@ func TestMocks(t *testing.T) {
 			Expect(mock.CallsToGauge[0].Str).To(Equal("some stat"))
 			Expect(mock.CallsToGauge[0].Num).To(Equal(int64(38)))
 		})
+		g.It("should record calls to Histogram", func() {
+			stats.(HistogramStatser).Histogram("request.db_calls", 3)
+			Expect(mock.CallsToHistogram).To(Equal([]HistogramSignature{{"request.db_calls", 3}}))
+		})
+		g.It("should record calls to Mark and total them per stat", func() {
+			meters := stats.(MeterStatser)
+			meters.Mark("requests", 2)
+			meters.Mark("errors", 1)
+			meters.Mark("requests", 3)
+			Expect(len(mock.CallsToMark)).To(Equal(3))
+			Expect(mock.Marked("requests")).To(Equal(int64(5)))
+			Expect(mock.Marked("errors")).To(Equal(int64(1)))
+			Expect(mock.Marked("nothing")).To(Equal(int64(0)))
+		})
+	})
+	g.Describe("FakeClock", func() {
+		g.It("should only move when advanced", func() {
+			start := time.Date(2015, 6, 1, 0, 0, 0, 0, time.UTC)
+			clock := NewFakeClock(start)
+			Expect(clock.Now()).To(Equal(start))
+			clock.Advance(time.Minute)
+			Expect(clock.Now()).To(Equal(start.Add(time.Minute)))
+		})
+		g.It("should fire After once its deadline has passed", func() {
+			clock := NewFakeClock(time.Now())
+			fired := clock.After(time.Second)
+			clock.Advance(999 * time.Millisecond)
+			Expect(fired).NotTo(Receive())
+			clock.Advance(time.Millisecond)
+			Expect(fired).To(Receive())
+		})
+		g.It("should let callers wait for a goroutine to call After", func() {
+			clock := NewFakeClock(time.Now())
+			done := make(chan bool)
+			go func() {
+				<-clock.After(time.Second)
+				done <- true
+			}()
+			clock.BlockUntil(1)
+			clock.Advance(time.Second)
+			Expect(<-done).To(BeTrue())
+		})
 	})
 }
@@ -0,0 +1,5 @@
+//go:build !race
+
+package gstats
+
+const raceEnabled = false
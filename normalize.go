@@ -0,0 +1,136 @@
+package gstats
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Normalizer turns free-form error text into a CamelCase stat path segment,
+// "connection refused" => "ConnectionRefused"
+type Normalizer struct {
+	// replace runs of text that cannot be transliterated to ASCII (Japanese,
+	// Cyrillic, ...) with a stable "X1a2b3c4d" token instead of dropping them
+	HashOtherScripts bool
+	// longest segment produced, zero means no limit
+	MaxLength int
+	// returned when nothing usable is left, "Unknown" if empty
+	Fallback string
+}
+
+var DefaultNormalizer = Normalizer{MaxLength: 64, Fallback: "Unknown"}
+
+// substrings that differ from one occurrence of an error to the next and
+// would otherwise give every occurrence a stat of its own
+var volatilePatterns = []*regexp.Regexp{
+	// quoted values, `open "/tmp/x": no such file`
+	regexp.MustCompile("\"[^\"]*\"|'[^']*'|`[^`]*`"),
+	regexp.MustCompile(`(?i)\b[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\b`),
+	regexp.MustCompile(`\b\d{1,3}(\.\d{1,3}){3}(:\d+)?\b`),
+	regexp.MustCompile(`(?i)\[?\b([0-9a-f]{0,4}:){2,7}[0-9a-f]{0,4}\b\]?(:\d+)?|\[::1?\](:\d+)?`),
+	regexp.MustCompile(`(?i)\b0x[0-9a-f]+\b`),
+	// durations, "30s", "250ms", "1m30s"
+	regexp.MustCompile(`\b(\d+(\.\d+)?(ns|us|µs|ms|s|m|h))+\b`),
+	regexp.MustCompile(`[-+]?\b\d+([.,]\d+)*\b`),
+}
+
+// long runs of hex digits are IDs, unless they are plain words like "deadbeef"
+var hexIDPattern = regexp.MustCompile(`(?i)\b[0-9a-f]{8,}\b`)
+
+// ASCII spellings of the Latin letters with diacritics in Latin-1 Supplement
+// and Latin Extended-A
+var transliterations = map[rune]string{}
+
+func init() {
+	for from, to := range map[string]string{
+		"ÀÁÂÃÄÅĀĂĄ": "A", "àáâãäåāăą": "a", "Æ": "AE", "æ": "ae",
+		"ÇĆĈĊČ": "C", "çćĉċč": "c", "ÐĎĐ": "D", "ðďđ": "d",
+		"ÈÉÊËĒĔĖĘĚ": "E", "èéêëēĕėęě": "e", "ĜĞĠĢ": "G", "ĝğġģ": "g",
+		"ĤĦ": "H", "ĥħ": "h", "ÌÍÎÏĨĪĬĮİ": "I", "ìíîïĩīĭįı": "i",
+		"Ĳ": "IJ", "ĳ": "ij", "Ĵ": "J", "ĵ": "j", "Ķ": "K", "ķĸ": "k",
+		"ĹĻĽĿŁ": "L", "ĺļľŀł": "l", "ÑŃŅŇŊ": "N", "ñńņňŉŋ": "n",
+		"ÒÓÔÕÖØŌŎŐ": "O", "òóôõöøōŏő": "o", "Œ": "OE", "œ": "oe",
+		"ŔŖŘ": "R", "ŕŗř": "r", "ŚŜŞŠ": "S", "śŝşšſ": "s", "ß": "ss",
+		"ŢŤŦ": "T", "ţťŧ": "t", "Þ": "TH", "þ": "th",
+		"ÙÚÛÜŨŪŬŮŰŲ": "U", "ùúûüũūŭůűų": "u", "Ŵ": "W", "ŵ": "w",
+		"ÝŶŸ": "Y", "ýÿŷ": "y", "ŹŻŽ": "Z", "źżž": "z",
+	} {
+		for _, r := range from {
+			transliterations[r] = to
+		}
+	}
+}
+
+// expected behavior to strip non-western characters
+func normalize(toRecord error) string {
+	return DefaultNormalizer.Normalize(toRecord.Error())
+}
+
+// "Timeout after 30s talking to 10.0.0.7:8125" => "TimeoutAfterTalkingTo"
+func (n Normalizer) Normalize(text string) string {
+	for _, p := range volatilePatterns {
+		text = p.ReplaceAllString(text, " ")
+	}
+	text = hexIDPattern.ReplaceAllStringFunc(text, func(id string) string {
+		if strings.IndexAny(id, "0123456789") >= 0 {
+			return " "
+		}
+		return id
+	})
+
+	words := []string{}
+	word := strings.Builder{}
+	other := strings.Builder{}
+	endWord := func() {
+		if word.Len() > 0 {
+			words = append(words, word.String())
+			word.Reset()
+		}
+	}
+	endOther := func() {
+		if other.Len() > 0 {
+			words = append(words, fmt.Sprintf("X%08x", hashString(other.String())))
+			other.Reset()
+		}
+	}
+	for _, r := range text {
+		switch {
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			endOther()
+			word.WriteRune(r)
+		case transliterations[r] != "":
+			endOther()
+			word.WriteString(transliterations[r])
+		case unicode.Is(unicode.Mn, r):
+			// combining accents, as in a decomposed "é", vanish without
+			// splitting the word they belong to
+			if other.Len() > 0 {
+				other.WriteRune(r)
+			}
+		case n.HashOtherScripts && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			endWord()
+			other.WriteRune(r)
+		default:
+			endWord()
+			endOther()
+		}
+	}
+	endWord()
+	endOther()
+
+	normalized := ""
+	for _, w := range words {
+		normalized += strings.ToUpper(w[:1]) + w[1:]
+	}
+	if n.MaxLength > 0 && len(normalized) > n.MaxLength {
+		normalized = normalized[:n.MaxLength]
+	}
+	if normalized != "" {
+		return normalized
+	}
+	if n.Fallback != "" {
+		return n.Fallback
+	}
+	return "Unknown"
+}
@@ -0,0 +1,61 @@
+package gstats
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	. "github.com/franela/goblin"
+	. "github.com/onsi/gomega"
+)
+
+func TestNormalizer(t *testing.T) {
+	g := Goblin(t)
+	RegisterFailHandler(func(m string, _ ...int) { g.Fail(m) })
+	g.Describe("Normalizer", func() {
+		g.It("should transliterate Latin diacritics", func() {
+			Expect(DefaultNormalizer.Normalize("échec de la connexion à la base")).To(Equal("EchecDeLaConnexionALaBase"))
+			Expect(DefaultNormalizer.Normalize("Größe überschritten")).To(Equal("GrosseUberschritten"))
+			// the same word with a decomposed accent, e + U+0301
+			Expect(DefaultNormalizer.Normalize("e\u0301chec")).To(Equal("Echec"))
+		})
+		g.It("should fall back to Unknown when nothing is left", func() {
+			Expect(DefaultNormalizer.Normalize("接続が拒否されました")).To(Equal("Unknown"))
+			Expect(DefaultNormalizer.Normalize("!!! 404 ???")).To(Equal("Unknown"))
+			Expect(Normalizer{Fallback: "Other"}.Normalize("")).To(Equal("Other"))
+			Expect(Normalizer{}.Normalize("")).To(Equal("Unknown"))
+		})
+		g.It("should hash other scripts to a stable token when asked to", func() {
+			hashing := Normalizer{HashOtherScripts: true}
+			first := hashing.Normalize("ошибка соединения")
+			Expect(first).To(MatchRegexp(`^X[0-9a-f]{8}X[0-9a-f]{8}$`))
+			Expect(hashing.Normalize("ошибка соединения")).To(Equal(first))
+			Expect(hashing.Normalize("ошибка")).NotTo(Equal(hashing.Normalize("соединения")))
+			Expect(hashing.Normalize("db 接続 failed")).To(MatchRegexp(`^DbX[0-9a-f]{8}Failed$`))
+		})
+		g.It("should strip volatile substrings", func() {
+			Expect(DefaultNormalizer.Normalize("timeout after 30 seconds talking to 10.0.0.7:8125")).To(Equal("TimeoutAfterSecondsTalkingTo"))
+			Expect(DefaultNormalizer.Normalize("Timeout after 30s talking to 10.0.0.7:8125")).To(Equal("TimeoutAfterTalkingTo"))
+			Expect(DefaultNormalizer.Normalize("deadline of 250ms exceeded after 1m30s, retry in 5m")).To(Equal("DeadlineOfExceededAfterRetryIn"))
+			Expect(DefaultNormalizer.Normalize("dial tcp [::1]:8125: connection refused")).To(Equal("DialTcpConnectionRefused"))
+			Expect(DefaultNormalizer.Normalize("dial tcp [2001:db8::1]:8125: connection refused")).To(Equal("DialTcpConnectionRefused"))
+			Expect(DefaultNormalizer.Normalize("order 3fa85f64-5717-4562-b3fc-2c963f66afa6 not found")).To(Equal("OrderNotFound"))
+			Expect(DefaultNormalizer.Normalize("object 5f2b9c1ad3e4 missing at 0x7ffd")).To(Equal("ObjectMissingAt"))
+			Expect(DefaultNormalizer.Normalize(`open "/tmp/x": no such file`)).To(Equal("OpenNoSuchFile"))
+			Expect(DefaultNormalizer.Normalize("user 'bob' locked")).To(Equal("UserLocked"))
+		})
+		g.It("should keep digits that are part of a word", func() {
+			Expect(DefaultNormalizer.Normalize("x509 certificate signed by unknown authority")).To(Equal("X509CertificateSignedByUnknownAuthority"))
+			Expect(DefaultNormalizer.Normalize("http2 stream reset")).To(Equal("Http2StreamReset"))
+		})
+		g.It("should cap the length", func() {
+			Expect(len(DefaultNormalizer.Normalize(strings.Repeat("word ", 50)))).To(Equal(64))
+			Expect(Normalizer{MaxLength: 5}.Normalize("connection refused")).To(Equal("Conne"))
+		})
+		g.It("should give recorded outcomes a non-empty name", func() {
+			mock := NewMock()
+			mock.IncResult("op", errors.New("ошибка"))
+			Expect(mock.CallsToIncResult[0].Outcomes).To(Equal([]string{"Unknown"}))
+		})
+	})
+}
@@ -0,0 +1,104 @@
+package gstats
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const openMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+// upper bounds of the buckets OpenMetricsHandler serves, in seconds. A last
+// +Inf bucket catches the rest.
+var tracedBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// every call timed with EndContext since the client started, with the latest
+// traced call of each bucket as its exemplar
+type tracedHistogram struct {
+	// per bucket, not cumulative, the last one is +Inf
+	counts    []uint64
+	exemplars []Exemplar
+	count     uint64
+	sum       time.Duration
+}
+
+// callers must hold s.exemplarMu
+func (s *Statistics) observe(stat string, e Exemplar) {
+	h, ok := s.traced[stat]
+	if !ok {
+		h = &tracedHistogram{
+			counts:    make([]uint64, len(tracedBuckets)+1),
+			exemplars: make([]Exemplar, len(tracedBuckets)+1),
+		}
+		s.traced[stat] = h
+	}
+	// the first bucket the call is not slower than
+	i := sort.SearchFloat64s(tracedBuckets, e.Duration.Seconds())
+	h.counts[i]++
+	if e.TraceID != "" {
+		h.exemplars[i] = e
+	}
+	h.count++
+	h.sum += e.Duration
+}
+
+// OpenMetricsHandler serves the calls timed with EndContext, TraceContext
+// included, for Prometheus to scrape, as one histogram, gstats_timer_seconds,
+// with the stat name as a "stat" label. Every bucket carries the trace ID of
+// its latest traced call as an exemplar, so a latency spike on a dashboard
+// links to a trace. Timers ended with End only go to statsd.
+// > http.Handle("/metrics", stats.OpenMetricsHandler())
+func (s *Statistics) OpenMetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", openMetricsContentType)
+		w.Write(s.openMetrics())
+	})
+}
+
+func (s *Statistics) openMetrics() []byte {
+	s.exemplarMu.Lock()
+	defer s.exemplarMu.Unlock()
+	stats := make([]string, 0, len(s.traced))
+	for stat := range s.traced {
+		stats = append(stats, stat)
+	}
+	sort.Strings(stats)
+	out := []byte("# TYPE gstats_timer_seconds histogram\n# HELP gstats_timer_seconds Calls timed with EndContext.\n")
+	for _, stat := range stats {
+		h := s.traced[stat]
+		label := `stat="` + openMetricsEscaper.Replace(stat) + `"`
+		cumulative := uint64(0)
+		for i, count := range h.counts {
+			cumulative += count
+			le := "+Inf"
+			if i < len(tracedBuckets) {
+				le = openMetricsFloat(tracedBuckets[i])
+			}
+			out = append(out, "gstats_timer_seconds_bucket{"+label+`,le="`+le+`"} `...)
+			out = strconv.AppendUint(out, cumulative, 10)
+			if e := h.exemplars[i]; e.TraceID != "" {
+				out = append(out, ` # {trace_id="`+openMetricsEscaper.Replace(e.TraceID)+`"} `...)
+				out = append(out, openMetricsFloat(e.Duration.Seconds())+" "...)
+				out = append(out, openMetricsFloat(float64(e.At.UnixNano())/float64(time.Second))...)
+			}
+			out = append(out, '\n')
+		}
+		out = append(out, "gstats_timer_seconds_count{"+label+"} "...)
+		out = strconv.AppendUint(out, h.count, 10)
+		out = append(out, "\ngstats_timer_seconds_sum{"+label+"} "+openMetricsFloat(h.sum.Seconds())+"\n"...)
+	}
+	return append(out, "# EOF\n"...)
+}
+
+var openMetricsEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// 1 => "1.0", 0.25 => "0.25"
+func openMetricsFloat(f float64) string {
+	formatted := strconv.FormatFloat(f, 'f', -1, 64)
+	if !strings.Contains(formatted, ".") {
+		formatted += ".0"
+	}
+	return formatted
+}
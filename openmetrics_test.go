@@ -0,0 +1,96 @@
+package gstats
+
+import (
+	"context"
+	"net"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/franela/goblin"
+	. "github.com/onsi/gomega"
+)
+
+func TestOpenMetrics(t *testing.T) {
+	g := Goblin(t)
+	RegisterFailHandler(func(m string, _ ...int) { g.Fail(m) })
+	g.Describe("OpenMetricsHandler", func() {
+		var sock *net.UDPConn
+		var stats *Statistics
+		var clock *FakeClock
+		g.BeforeEach(func() {
+			var err error
+			sock, err = net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+			Expect(err).NotTo(HaveOccurred())
+			os.Setenv("STATSD_ADDRESS", sock.LocalAddr().String())
+			os.Setenv("STATSD_PREFIX", "test")
+			clock = NewFakeClock(time.Unix(1700000000, 0))
+			stats, err = CreateStatsdClientWithOptions(Options{Clock: clock, BufferFlushPeriod: time.Hour})
+			Expect(err).NotTo(HaveOccurred())
+		})
+		g.AfterEach(func() {
+			sock.Close()
+		})
+		g.It("should serve EndContext timers as a histogram with trace exemplars", func() {
+			calls := []struct {
+				traceID  string
+				duration time.Duration
+			}{{"", 3 * time.Millisecond}, {"a", 12 * time.Millisecond}, {"b", 7 * time.Second}}
+			for _, call := range calls {
+				ctx := context.Background()
+				if call.traceID != "" {
+					ctx = WithTraceParent(ctx, "00-"+helper_TraceID(call.traceID)+"-00f067aa0ba902b7-01")
+				}
+				name, start, inc := stats.Trace("checkout")
+				clock.Advance(call.duration)
+				stats.EndContext(ctx, name, start, inc)
+			}
+			// End is for statsd only
+			name, start, inc := stats.Trace("other")
+			stats.End(name, start, inc)
+
+			recorder := httptest.NewRecorder()
+			stats.OpenMetricsHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+			Expect(recorder.Header().Get("Content-Type")).To(Equal("application/openmetrics-text; version=1.0.0; charset=utf-8"))
+			Expect(recorder.Body.String()).To(Equal(strings.Join([]string{
+				"# TYPE gstats_timer_seconds histogram",
+				"# HELP gstats_timer_seconds Calls timed with EndContext.",
+				`gstats_timer_seconds_bucket{stat="checkout",le="0.005"} 1`,
+				`gstats_timer_seconds_bucket{stat="checkout",le="0.01"} 1`,
+				`gstats_timer_seconds_bucket{stat="checkout",le="0.025"} 2 # {trace_id="` + helper_TraceID("a") + `"} 0.012 1700000000.015`,
+				`gstats_timer_seconds_bucket{stat="checkout",le="0.05"} 2`,
+				`gstats_timer_seconds_bucket{stat="checkout",le="0.1"} 2`,
+				`gstats_timer_seconds_bucket{stat="checkout",le="0.25"} 2`,
+				`gstats_timer_seconds_bucket{stat="checkout",le="0.5"} 2`,
+				`gstats_timer_seconds_bucket{stat="checkout",le="1.0"} 2`,
+				`gstats_timer_seconds_bucket{stat="checkout",le="2.5"} 2`,
+				`gstats_timer_seconds_bucket{stat="checkout",le="5.0"} 2`,
+				`gstats_timer_seconds_bucket{stat="checkout",le="10.0"} 3 # {trace_id="` + helper_TraceID("b") + `"} 7.0 1700000007.015`,
+				`gstats_timer_seconds_bucket{stat="checkout",le="+Inf"} 3`,
+				`gstats_timer_seconds_count{stat="checkout"} 3`,
+				`gstats_timer_seconds_sum{stat="checkout"} 7.015`,
+				"# EOF",
+				"",
+			}, "\n")))
+		})
+		g.It("should serve TraceContext timers too", func() {
+			ctx := WithTraceParent(context.Background(), "00-"+helper_TraceID("c")+"-00f067aa0ba902b7-01")
+			_, end := stats.TraceContext(ctx, "search")
+			clock.Advance(20 * time.Millisecond)
+			end()
+			recorder := httptest.NewRecorder()
+			stats.OpenMetricsHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+			Expect(recorder.Body.String()).To(ContainSubstring(`gstats_timer_seconds_bucket{stat="search",le="0.025"} 1 # {trace_id="` + helper_TraceID("c") + `"} 0.02 1700000000.02`))
+			Expect(recorder.Body.String()).To(ContainSubstring(`gstats_timer_seconds_count{stat="search"} 1`))
+		})
+		g.It("should escape stat names in labels", func() {
+			name, start, inc := stats.Trace(`say "hi"`)
+			stats.EndContext(context.Background(), name, start, inc)
+			recorder := httptest.NewRecorder()
+			stats.OpenMetricsHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+			Expect(recorder.Body.String()).To(ContainSubstring(`gstats_timer_seconds_count{stat="say \"hi\""} 1`))
+		})
+	})
+}
@@ -0,0 +1,189 @@
+// Package pool runs tasks on a fixed number of goroutines and reports how
+// the pool is doing through a gstats.Statser:
+//
+//	name.queue.depth       gauge, tasks waiting for a worker
+//	name.workers.active    gauge, workers running a task
+//	name.wait              timer, from Submit until a worker picks the task up
+//	name.task              timer and count, running the task
+//	name.task.<Error>      count of tasks that failed, named like IncErr does
+//	name.task.panic.<...>  count of tasks that panicked, see RecoverAndCount
+//	name.rejected          count of tasks Submit turned away
+//
+// > workers := pool.New(stats, "thumbnails", pool.Options{Workers: 8, QueueSize: 100})
+// > defer workers.Close()
+// > err := workers.Submit(func() error { return resize(image) })
+package pool
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/monsooncommerce/gstats"
+)
+
+var (
+	ErrFull   = errors.New("pool queue is full")
+	ErrClosed = errors.New("pool is closed")
+)
+
+type Options struct {
+	// goroutines running tasks, defaults to 1
+	Workers int
+	// tasks that can wait for a worker, zero means Submit only succeeds
+	// when a worker is idle
+	QueueSize int
+	// how often the gauges are sent, defaults to one second
+	ReportInterval time.Duration
+}
+
+type task struct {
+	f         func() error
+	submitted time.Time
+}
+
+type Pool struct {
+	stats  gstats.Statser
+	name   string
+	tasks  chan task
+	active atomic.Int64
+	// held for reading while submitting, so Close does not close tasks
+	// under a sender. SubmitWait lets go of it before it blocks and is
+	// counted in waiting instead, closing wakes it up.
+	mu      sync.RWMutex
+	closed  bool
+	closing chan bool
+	waiting sync.WaitGroup
+	workers sync.WaitGroup
+	stop    chan bool
+	stopped chan bool
+}
+
+// New starts the workers, a nil Statser means gstats.Default()
+func New(stats gstats.Statser, name string, opts Options) *Pool {
+	if stats == nil {
+		stats = gstats.Default()
+	}
+	if opts.Workers < 1 {
+		opts.Workers = 1
+	}
+	if opts.ReportInterval <= 0 {
+		opts.ReportInterval = time.Second
+	}
+	p := &Pool{
+		stats:   stats,
+		name:    name,
+		tasks:   make(chan task, opts.QueueSize),
+		closing: make(chan bool),
+		stop:    make(chan bool),
+		stopped: make(chan bool),
+	}
+	for i := 0; i < opts.Workers; i++ {
+		p.workers.Add(1)
+		go p.work()
+	}
+	go p.reportEvery(opts.ReportInterval)
+	return p
+}
+
+// Submit queues f without waiting, returning ErrFull when there is no room
+// and ErrClosed after Close
+func (p *Pool) Submit(f func() error) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return p.reject(ErrClosed)
+	}
+	select {
+	case p.tasks <- task{f, time.Now()}:
+		return nil
+	default:
+		return p.reject(ErrFull)
+	}
+}
+
+// SubmitWait queues f, waiting for room until ctx is done or the pool is
+// closed
+func (p *Pool) SubmitWait(ctx context.Context, f func() error) error {
+	p.mu.RLock()
+	if p.closed {
+		p.mu.RUnlock()
+		return p.reject(ErrClosed)
+	}
+	p.waiting.Add(1)
+	p.mu.RUnlock()
+	defer p.waiting.Done()
+	select {
+	case p.tasks <- task{f, time.Now()}:
+		return nil
+	case <-p.closing:
+		return p.reject(ErrClosed)
+	case <-ctx.Done():
+		return p.reject(ctx.Err())
+	}
+}
+
+func (p *Pool) reject(err error) error {
+	p.stats.Inc(p.name + ".rejected")
+	return err
+}
+
+// Close stops taking tasks and waits for the queued ones to finish
+func (p *Pool) Close() {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+	p.closed = true
+	close(p.closing)
+	p.mu.Unlock()
+	p.waiting.Wait()
+	close(p.tasks)
+	p.workers.Wait()
+	close(p.stop)
+	<-p.stopped
+}
+
+func (p *Pool) work() {
+	defer p.workers.Done()
+	for t := range p.tasks {
+		p.run(t)
+	}
+}
+
+func (p *Pool) run(t task) {
+	p.stats.End(p.name+".wait", t.submitted, 0)
+	p.active.Add(1)
+	start := time.Now()
+	defer func() {
+		p.stats.End(p.name+".task", start, 1)
+		p.active.Add(-1)
+	}()
+	// runs before the timing above, a panicking task is timed too
+	defer gstats.RecoverAndCount(p.stats, p.name+".task")
+	p.stats.IncErr(p.name+".task", t.f())
+}
+
+func (p *Pool) reportEvery(interval time.Duration) {
+	defer close(p.stopped)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.report()
+		case <-p.stop:
+			// the pool is drained, send the zeros
+			p.report()
+			return
+		}
+	}
+}
+
+func (p *Pool) report() {
+	p.stats.Gauge(p.name+".queue.depth", int64(len(p.tasks)))
+	p.stats.Gauge(p.name+".workers.active", p.active.Load())
+}
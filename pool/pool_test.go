@@ -0,0 +1,116 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/franela/goblin"
+	"github.com/monsooncommerce/gstats"
+	. "github.com/onsi/gomega"
+)
+
+func helper_Names(calls []gstats.EndSignature) []string {
+	names := []string{}
+	for _, call := range calls {
+		names = append(names, call.Str)
+	}
+	return names
+}
+
+func TestPool(t *testing.T) {
+	g := Goblin(t)
+	RegisterFailHandler(func(m string, _ ...int) { g.Fail(m) })
+	g.Describe("Pool", func() {
+		var mock gstats.MockStatser
+		g.BeforeEach(func() {
+			mock = gstats.NewMock()
+		})
+		g.It("should time waiting and running, and count failures", func() {
+			p := New(&mock, "jobs", Options{Workers: 1, QueueSize: 10, ReportInterval: time.Hour})
+			Expect(p.Submit(func() error { return nil })).NotTo(HaveOccurred())
+			Expect(p.Submit(func() error { return errors.New("connection refused") })).NotTo(HaveOccurred())
+			p.Close()
+			Expect(helper_Names(mock.CallsToEnd)).To(Equal([]string{"jobs.wait", "jobs.task", "jobs.wait", "jobs.task"}))
+			Expect(mock.CallsToEnd[0].Num).To(Equal(int64(0)))
+			Expect(mock.CallsToEnd[1].Num).To(Equal(int64(1)))
+			Expect(len(mock.CallsToIncErr)).To(Equal(2))
+			Expect(mock.CallsToIncErr[0].Err).To(BeNil())
+			Expect(mock.CallsToIncErr[1].Err).To(MatchError("connection refused"))
+			// the report on Close
+			Expect(mock.CallsToGauge).To(Equal([]gstats.GaugeSignature{{Str: "jobs.queue.depth", Num: 0}, {Str: "jobs.workers.active", Num: 0}}))
+		})
+		g.It("should reject tasks when the queue is full or the pool is closed", func() {
+			release := make(chan bool)
+			started := make(chan bool)
+			p := New(&mock, "jobs", Options{Workers: 1, QueueSize: 1, ReportInterval: time.Hour})
+			Expect(p.Submit(func() error { started <- true; <-release; return nil })).NotTo(HaveOccurred())
+			<-started
+			Expect(p.Submit(func() error { return nil })).NotTo(HaveOccurred())
+			Expect(p.Submit(func() error { return nil })).To(Equal(ErrFull))
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+			Expect(p.SubmitWait(ctx, func() error { return nil })).To(Equal(context.DeadlineExceeded))
+
+			p.report()
+			Expect(mock.CallsToGauge).To(Equal([]gstats.GaugeSignature{{Str: "jobs.queue.depth", Num: 1}, {Str: "jobs.workers.active", Num: 1}}))
+			close(release)
+			p.Close()
+			Expect(p.Submit(func() error { return nil })).To(Equal(ErrClosed))
+			Expect(mock.CallsToInc).To(Equal([]gstats.IncSignature{{IncVal: "jobs.rejected"}, {IncVal: "jobs.rejected"}, {IncVal: "jobs.rejected"}}))
+		})
+		g.It("should wait for room when asked to", func() {
+			p := New(&mock, "jobs", Options{Workers: 2, QueueSize: 0, ReportInterval: time.Hour})
+			done := sync.WaitGroup{}
+			for i := 0; i < 20; i++ {
+				done.Add(1)
+				Expect(p.SubmitWait(context.Background(), func() error { done.Done(); return nil })).NotTo(HaveOccurred())
+			}
+			done.Wait()
+			p.Close()
+			Expect(mock.CallsToInc).To(BeEmpty())
+		})
+		g.It("should stop waiting for room when closed, without blocking Submit", func() {
+			release := make(chan bool)
+			started := make(chan bool)
+			p := New(&mock, "jobs", Options{Workers: 1, QueueSize: 1, ReportInterval: time.Hour})
+			Expect(p.Submit(func() error { started <- true; <-release; return nil })).NotTo(HaveOccurred())
+			<-started
+			Expect(p.Submit(func() error { return nil })).NotTo(HaveOccurred())
+			waited := make(chan error)
+			go func() { waited <- p.SubmitWait(context.Background(), func() error { return nil }) }()
+			time.Sleep(10 * time.Millisecond)
+			closed := make(chan bool)
+			go func() { p.Close(); close(closed) }()
+			Eventually(waited).Should(Receive(Equal(ErrClosed)))
+			submitted := make(chan error)
+			go func() { submitted <- p.Submit(func() error { return nil }) }()
+			Eventually(submitted).Should(Receive(Equal(ErrClosed)))
+			close(release)
+			Eventually(closed).Should(BeClosed())
+		})
+		g.It("should count panics and keep the worker going", func() {
+			p := New(&mock, "jobs", Options{Workers: 1, QueueSize: 2, ReportInterval: time.Hour})
+			Expect(p.Submit(func() error { panic("bug") })).NotTo(HaveOccurred())
+			Expect(p.Submit(func() error { return nil })).NotTo(HaveOccurred())
+			p.Close()
+			Expect(mock.CallsToInc).To(Equal([]gstats.IncSignature{{IncVal: "jobs.task.panic.String"}}))
+			Expect(helper_Names(mock.CallsToEnd)).To(Equal([]string{"jobs.wait", "jobs.task", "jobs.wait", "jobs.task"}))
+			Expect(len(mock.CallsToIncErr)).To(Equal(1))
+		})
+		g.It("should report on its interval", func() {
+			p := New(&mock, "jobs", Options{ReportInterval: time.Millisecond})
+			time.Sleep(20 * time.Millisecond)
+			p.Close()
+			Expect(len(mock.CallsToGauge)).To(BeNumerically(">", 2))
+		})
+		g.It("should be closable twice", func() {
+			p := New(&mock, "jobs", Options{})
+			p.Close()
+			p.Close()
+		})
+	})
+}
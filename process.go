@@ -0,0 +1,150 @@
+package gstats
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// clock ticks per second in /proc/self/stat, USER_HZ is 100 on every
+// architecture Linux runs on
+const procClockTicks = 100
+
+// ProcessCollector reads this process's resource usage from /proc on Linux:
+//
+//	cpu.user_ms, cpu.system_ms          CPU time used since the process started
+//	memory.rss_bytes, memory.virtual_bytes
+//	fds.open, fds.limit                 open file descriptors and the soft limit
+//	threads
+//	io.read_bytes, io.write_bytes       bytes read from and written to storage
+//
+// > stats.RegisterCollector("process", gstats.NewProcessCollector(""), 0)
+//
+// Files that cannot be read, e.g. on other systems, are skipped.
+type ProcessCollector struct {
+	// where proc is mounted, tests point this at a fixture directory
+	Root string
+}
+
+// "" reads the real /proc
+func NewProcessCollector(root string) *ProcessCollector {
+	if root == "" {
+		root = "/proc"
+	}
+	return &ProcessCollector{Root: root}
+}
+
+func (p *ProcessCollector) path(name string) string {
+	return filepath.Join(p.Root, "self", name)
+}
+
+func (p *ProcessCollector) Collect(emit func(name string, value float64)) {
+	p.collectStat(emit)
+	p.collectStatus(emit)
+	p.collectFds(emit)
+	p.collectIO(emit)
+}
+
+// /proc/self/stat is one line of space separated fields, utime and stime are
+// the 14th and 15th. The command name in field 2 can hold spaces, so fields
+// are counted from the ")" that closes it.
+func (p *ProcessCollector) collectStat(emit func(string, float64)) {
+	stat, err := os.ReadFile(p.path("stat"))
+	if err != nil {
+		return
+	}
+	line := string(stat)
+	fields := strings.Fields(line[strings.LastIndex(line, ")")+1:])
+	// fields[0] is field 3
+	if len(fields) < 13 {
+		return
+	}
+	if utime, err := strconv.ParseFloat(fields[11], 64); err == nil {
+		emit("cpu.user_ms", utime*1000/procClockTicks)
+	}
+	if stime, err := strconv.ParseFloat(fields[12], 64); err == nil {
+		emit("cpu.system_ms", stime*1000/procClockTicks)
+	}
+}
+
+// "VmRSS:	    1234 kB" lines
+func (p *ProcessCollector) collectStatus(emit func(string, float64)) {
+	fields := readKeyValues(p.path("status"), ":")
+	if kb, ok := fields["VmRSS"]; ok {
+		emit("memory.rss_bytes", kb*1024)
+	}
+	if kb, ok := fields["VmSize"]; ok {
+		emit("memory.virtual_bytes", kb*1024)
+	}
+	if threads, ok := fields["Threads"]; ok {
+		emit("threads", threads)
+	}
+}
+
+func (p *ProcessCollector) collectFds(emit func(string, float64)) {
+	if fds, err := os.ReadDir(p.path("fd")); err == nil {
+		open := len(fds)
+		// the real fd directory lists the descriptor ReadDir opened to read it
+		if p.Root == "/proc" {
+			open--
+		}
+		emit("fds.open", float64(open))
+	}
+	f, err := os.Open(p.path("limits"))
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// Max open files            1024                 4096                 files
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "Max open files") {
+			continue
+		}
+		fields := strings.Fields(line[len("Max open files"):])
+		if len(fields) == 0 {
+			return
+		}
+		if limit, err := strconv.ParseFloat(fields[0], 64); err == nil {
+			emit("fds.limit", limit)
+		}
+		return
+	}
+}
+
+// "read_bytes: 1234" lines
+func (p *ProcessCollector) collectIO(emit func(string, float64)) {
+	fields := readKeyValues(p.path("io"), ":")
+	if read, ok := fields["read_bytes"]; ok {
+		emit("io.read_bytes", read)
+	}
+	if written, ok := fields["write_bytes"]; ok {
+		emit("io.write_bytes", written)
+	}
+}
+
+// reads "key<separator> number [unit]" lines into a map, lines that do not
+// look like that are skipped
+func readKeyValues(path, separator string) map[string]float64 {
+	values := map[string]float64{}
+	f, err := os.Open(path)
+	if err != nil {
+		return values
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, rest, found := strings.Cut(scanner.Text(), separator)
+		fields := strings.Fields(rest)
+		if !found || len(fields) == 0 {
+			continue
+		}
+		if value, err := strconv.ParseFloat(fields[0], 64); err == nil {
+			values[strings.TrimSpace(key)] = value
+		}
+	}
+	return values
+}
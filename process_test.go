@@ -0,0 +1,74 @@
+package gstats
+
+import (
+	"net"
+	"os"
+	"runtime"
+	"testing"
+	"time"
+
+	. "github.com/franela/goblin"
+	. "github.com/onsi/gomega"
+)
+
+func helper_Collect(c Collector) map[string]float64 {
+	values := map[string]float64{}
+	c.Collect(func(name string, value float64) { values[name] = value })
+	return values
+}
+
+func TestProcessCollector(t *testing.T) {
+	g := Goblin(t)
+	RegisterFailHandler(func(m string, _ ...int) { g.Fail(m) })
+	g.Describe("ProcessCollector", func() {
+		g.It("should read the process from a proc directory", func() {
+			Expect(helper_Collect(NewProcessCollector("testdata/proc"))).To(Equal(map[string]float64{
+				"cpu.user_ms":          2500,
+				"cpu.system_ms":        750,
+				"memory.rss_bytes":     10240 * 1024,
+				"memory.virtual_bytes": 1048576 * 1024,
+				"threads":              12,
+				"fds.open":             5,
+				"fds.limit":            1024,
+				"io.read_bytes":        409600,
+				"io.write_bytes":       8192,
+			}))
+		})
+		g.It("should skip what it cannot read", func() {
+			Expect(helper_Collect(NewProcessCollector("testdata/nowhere"))).To(BeEmpty())
+		})
+		g.It("should read the real /proc by default", func() {
+			if runtime.GOOS != "linux" {
+				return
+			}
+			values := helper_Collect(NewProcessCollector(""))
+			Expect(values["memory.rss_bytes"]).To(BeNumerically(">", 0))
+			Expect(values["threads"]).To(BeNumerically(">=", 1))
+			Expect(values["fds.open"]).To(BeNumerically(">=", 3))
+		})
+		g.It("should not count the descriptor it reads /proc/self/fd with", func() {
+			if runtime.GOOS != "linux" {
+				return
+			}
+			fds, err := os.ReadDir("/proc/self/fd")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(helper_Collect(NewProcessCollector(""))["fds.open"]).To(Equal(float64(len(fds) - 1)))
+		})
+		g.It("should send the values as gauges once registered", func() {
+			sock, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+			Expect(err).NotTo(HaveOccurred())
+			defer sock.Close()
+			os.Setenv("STATSD_ADDRESS", sock.LocalAddr().String())
+			os.Setenv("STATSD_PREFIX", "test")
+			clock := NewFakeClock(time.Now())
+			stats, err := CreateStatsdClientWithOptions(Options{Clock: clock, BufferFlushPeriod: time.Hour})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stats.RegisterCollector("process", NewProcessCollector("testdata/proc"), time.Second)).NotTo(HaveOccurred())
+			clock.BlockUntil(2)
+			clock.Advance(time.Second)
+			Expect(helper_ReadUDP(sock)).To(Equal("test.process.cpu.user_ms:2500|g"))
+			Expect(helper_ReadUDP(sock)).To(Equal("test.process.cpu.system_ms:750|g"))
+			Expect(helper_ReadUDP(sock)).To(Equal("test.process.memory.rss_bytes:10485760|g"))
+		})
+	})
+}
@@ -0,0 +1,37 @@
+package gstats
+
+import (
+	"context"
+	"runtime/pprof"
+	"runtime/trace"
+)
+
+// the pprof label TraceContext sets to the stat name
+const profileLabel = "gstats_stat"
+
+// TraceContext times like Trace, and when Options.ProfileLabels is set it
+// also labels the goroutine gstats_stat=<name> for CPU profiles and opens a
+// runtime/trace task and region of the same name, so profiles and execution
+// traces can be sliced by the names used on dashboards. Calling end sends the
+// timer with EndContext, so a trace in ctx is kept as an exemplar, then ends
+// the region and task and restores ctx's labels, it must be called on the
+// same goroutine.
+// > ctx, end := stats.TraceContext(ctx, "checkout")
+// > defer end()
+func (s *Statistics) TraceContext(ctx context.Context, name string) (context.Context, func()) {
+	start := s.clock.Now()
+	if !s.profileLabels {
+		return ctx, func() { s.EndContext(ctx, name, start, 0) }
+	}
+	parent := ctx
+	ctx = pprof.WithLabels(ctx, pprof.Labels(profileLabel, name))
+	pprof.SetGoroutineLabels(ctx)
+	ctx, task := trace.NewTask(ctx, name)
+	region := trace.StartRegion(ctx, name)
+	return ctx, func() {
+		region.End()
+		task.End()
+		pprof.SetGoroutineLabels(parent)
+		s.EndContext(parent, name, start, 0)
+	}
+}
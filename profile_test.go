@@ -0,0 +1,115 @@
+package gstats
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"os"
+	"runtime/pprof"
+	"runtime/trace"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/franela/goblin"
+	. "github.com/onsi/gomega"
+)
+
+// the labels of every goroutine, as the goroutine profile shows them
+func helper_GoroutineLabels() string {
+	out := bytes.Buffer{}
+	pprof.Lookup("goroutine").WriteTo(&out, 1)
+	labels := []string{}
+	for _, line := range strings.Split(out.String(), "\n") {
+		if strings.HasPrefix(line, "# labels:") {
+			labels = append(labels, line)
+		}
+	}
+	return strings.Join(labels, "\n")
+}
+
+func TestProfileLabels(t *testing.T) {
+	g := Goblin(t)
+	RegisterFailHandler(func(m string, _ ...int) { g.Fail(m) })
+	g.Describe("TraceContext", func() {
+		var sock *net.UDPConn
+		var clock *FakeClock
+		g.BeforeEach(func() {
+			var err error
+			sock, err = net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+			Expect(err).NotTo(HaveOccurred())
+			os.Setenv("STATSD_ADDRESS", sock.LocalAddr().String())
+			os.Setenv("STATSD_PREFIX", "test")
+			clock = NewFakeClock(time.Now())
+		})
+		g.AfterEach(func() {
+			sock.Close()
+		})
+		g.It("should only time without the option", func() {
+			stats, err := CreateStatsdClientWithOptions(Options{Clock: clock, BufferFlushPeriod: time.Hour})
+			Expect(err).NotTo(HaveOccurred())
+			ctx, end := stats.TraceContext(context.Background(), "checkout")
+			_, labeled := pprof.Label(ctx, profileLabel)
+			Expect(labeled).To(BeFalse())
+			clock.Advance(3 * time.Millisecond)
+			end()
+			Expect(helper_ReadUDP(sock)).To(Equal("test.checkout:3|ms"))
+		})
+		g.It("should label the goroutine for as long as it is timing", func() {
+			stats, err := CreateStatsdClientWithOptions(Options{Clock: clock, BufferFlushPeriod: time.Hour, ProfileLabels: true})
+			Expect(err).NotTo(HaveOccurred())
+			outer := pprof.WithLabels(context.Background(), pprof.Labels("service", "shop"))
+			pprof.SetGoroutineLabels(outer)
+			defer pprof.SetGoroutineLabels(context.Background())
+
+			ctx, end := stats.TraceContext(outer, "checkout")
+			name, _ := pprof.Label(ctx, profileLabel)
+			Expect(name).To(Equal("checkout"))
+			Expect(helper_GoroutineLabels()).To(ContainSubstring(`"gstats_stat":"checkout"`))
+			clock.Advance(7 * time.Millisecond)
+			end()
+			Expect(helper_ReadUDP(sock)).To(Equal("test.checkout:7|ms"))
+			Expect(helper_GoroutineLabels()).NotTo(ContainSubstring("gstats_stat"))
+			Expect(helper_GoroutineLabels()).To(ContainSubstring(`"service":"shop"`))
+		})
+		g.It("should keep the trace in ctx as an exemplar while labeling", func() {
+			stats, err := CreateStatsdClientWithOptions(Options{Clock: clock, BufferFlushPeriod: time.Hour, ProfileLabels: true})
+			Expect(err).NotTo(HaveOccurred())
+			traced := WithTraceParent(context.Background(), "00-"+helper_TraceID("a")+"-00f067aa0ba902b7-01")
+			ctx, end := stats.TraceContext(traced, "checkout")
+			Expect(helper_GoroutineLabels()).To(ContainSubstring(`"gstats_stat":"checkout"`))
+			Expect(TraceParentID(ctx)).To(Equal(helper_TraceID("a")))
+			clock.Advance(7 * time.Millisecond)
+			end()
+			Expect(helper_ReadUDP(sock)).To(Equal("test.checkout:7|ms"))
+			Expect(helper_GoroutineLabels()).NotTo(ContainSubstring("gstats_stat"))
+			slowest := stats.Slowest()["checkout"]
+			Expect(len(slowest)).To(Equal(1))
+			Expect(slowest[0].TraceID).To(Equal(helper_TraceID("a")))
+			Expect(slowest[0].Duration).To(Equal(7 * time.Millisecond))
+		})
+		g.It("should open a task and region in execution traces", func() {
+			if trace.IsEnabled() {
+				return
+			}
+			stats, err := CreateStatsdClientWithOptions(Options{Clock: clock, BufferFlushPeriod: time.Hour, ProfileLabels: true})
+			Expect(err).NotTo(HaveOccurred())
+			out := bytes.Buffer{}
+			Expect(trace.Start(&out)).NotTo(HaveOccurred())
+			_, end := stats.TraceContext(context.Background(), "traced.checkout")
+			end()
+			trace.Stop()
+			Expect(out.String()).To(ContainSubstring("traced.checkout"))
+		})
+		g.It("should read the option from STATSD_PROFILE_LABELS", func() {
+			defer os.Unsetenv("STATSD_PROFILE_LABELS")
+			os.Setenv("STATSD_PROFILE_LABELS", "true")
+			stats, err := CreateStatsdClientWithOptions(Options{Clock: clock, BufferFlushPeriod: time.Hour})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stats.profileLabels).To(BeTrue())
+			os.Setenv("STATSD_PROFILE_LABELS", "maybe")
+			_, err = CreateStatsdClientWithOptions(Options{Clock: clock})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+}
@@ -0,0 +1,7 @@
+//go:build race
+
+package gstats
+
+// sync.Pool drops items at random under the race detector, so allocation
+// counts are meaningless
+const raceEnabled = true
@@ -0,0 +1,82 @@
+package gstats
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// RecoverAndCount stops a panic and counts it as
+// "stat.panic.<what panicked>.count". Error panics are named by their
+// normalized text, like IncErr, anything else by its type. Time, TimeValue
+// and collectors count their panics the same way. A nil Statser means
+// Default().
+// > defer gstats.RecoverAndCount(stats, "worker")
+func RecoverAndCount(s Statser, stat string) {
+	// recover only works when called by the deferred function itself
+	if r := recover(); r != nil {
+		countPanic(s, stat, r)
+	}
+}
+
+// CountAndRepanic counts a panic like RecoverAndCount and then panics again
+// with the same value, for panics that should still crash the process.
+// Buffered stats are flushed first, so nothing is lost with the process.
+// > defer gstats.CountAndRepanic(stats, "main")
+func CountAndRepanic(s Statser, stat string) {
+	if r := recover(); r != nil {
+		countPanic(s, stat, r)
+		if stats, ok := s.(*Statistics); ok {
+			stats.Flush()
+		}
+		panic(r)
+	}
+}
+
+// Go runs f in a goroutine of its own, counting and stopping any panic
+// like RecoverAndCount
+// > gstats.Go(stats, "reindex", reindex)
+func Go(s Statser, stat string, f func()) {
+	go func() {
+		defer RecoverAndCount(s, stat)
+		f()
+	}()
+}
+
+// RecoverHandler counts panics in next like RecoverAndCount and answers
+// 500 Internal Server Error instead of dropping the connection.
+// http.ErrAbortHandler is left to abort the request as it is meant to.
+// > http.Handle("/", gstats.RecoverHandler(stats, "http", mux))
+func RecoverHandler(s Statser, stat string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if p := recover(); p != nil {
+				if p == http.ErrAbortHandler {
+					panic(p)
+				}
+				countPanic(s, stat, p)
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			}
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+func countPanic(s Statser, stat string, value interface{}) {
+	if s == nil {
+		s = Default()
+	}
+	normalizer := DefaultNormalizer
+	if stats, ok := s.(*Statistics); ok {
+		normalizer = stats.Normalizer
+	}
+	s.Inc(stat + ".panic." + panicName(value, normalizer))
+}
+
+// errors.New("connection refused") => "ConnectionRefused", "oops" => "String",
+// &MyError{} => "MainMyError"
+func panicName(value interface{}, normalizer Normalizer) string {
+	if err, ok := value.(error); ok {
+		return normalizer.Normalize(err.Error())
+	}
+	return normalizer.Normalize(fmt.Sprintf("%T", value))
+}
@@ -0,0 +1,89 @@
+package gstats
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/franela/goblin"
+	. "github.com/onsi/gomega"
+)
+
+type helper_PanicValue struct{}
+
+func TestRecover(t *testing.T) {
+	g := Goblin(t)
+	RegisterFailHandler(func(m string, _ ...int) { g.Fail(m) })
+	g.Describe("Panic recovery", func() {
+		var mock MockStatser
+		g.BeforeEach(func() {
+			mock = NewMock()
+		})
+		g.It("should name panics by their normalized error or their type", func() {
+			Expect(panicName(errors.New("connection refused"), DefaultNormalizer)).To(Equal("ConnectionRefused"))
+			Expect(panicName("oops", DefaultNormalizer)).To(Equal("String"))
+			Expect(panicName(42, DefaultNormalizer)).To(Equal("Int"))
+			Expect(panicName(&helper_PanicValue{}, DefaultNormalizer)).To(Equal("GstatsHelperPanicValue"))
+			var nilMap map[string]int
+			func() {
+				defer func() {
+					Expect(panicName(recover(), DefaultNormalizer)).To(Equal("AssignmentToEntryInNilMap"))
+				}()
+				nilMap["x"] = 1
+			}()
+		})
+		g.It("should count and stop a panic", func() {
+			func() {
+				defer RecoverAndCount(&mock, "worker")
+				panic(errors.New("connection refused"))
+			}()
+			Expect(mock.CallsToInc).To(Equal([]IncSignature{{"worker.panic.ConnectionRefused"}}))
+		})
+		g.It("should count nothing without a panic", func() {
+			func() {
+				defer RecoverAndCount(&mock, "worker")
+			}()
+			Expect(mock.CallsToInc).To(BeEmpty())
+		})
+		g.It("should count and carry on panicking when asked to", func() {
+			Expect(func() {
+				defer CountAndRepanic(&mock, "main")
+				panic("fatal")
+			}).To(Panic())
+			Expect(mock.CallsToInc).To(Equal([]IncSignature{{"main.panic.String"}}))
+		})
+		g.It("should count panics in goroutines", func() {
+			done := make(chan bool)
+			Go(&mock, "reindex", func() {
+				defer close(done)
+				panic("lost")
+			})
+			<-done
+			Eventually(func() int {
+				mu.Lock()
+				defer mu.Unlock()
+				return len(mock.CallsToInc)
+			}, time.Second).Should(Equal(1))
+		})
+		g.It("should answer 500 for handlers that panic", func() {
+			handler := RecoverHandler(&mock, "http", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				panic(errors.New("template missing"))
+			}))
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+			Expect(recorder.Code).To(Equal(http.StatusInternalServerError))
+			Expect(mock.CallsToInc).To(Equal([]IncSignature{{"http.panic.TemplateMissing"}}))
+		})
+		g.It("should let aborted requests abort", func() {
+			handler := RecoverHandler(&mock, "http", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				panic(http.ErrAbortHandler)
+			}))
+			Expect(func() {
+				handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+			}).To(Panic())
+			Expect(mock.CallsToInc).To(BeEmpty())
+		})
+	})
+}
@@ -0,0 +1,124 @@
+package gstats
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// Resolver looks up the IP addresses of the statsd host. *net.Resolver
+// satisfies it, tests can inject their own.
+type Resolver interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// keeps a transport pointed at whatever the statsd hostname currently
+// resolves to, re-dialing and swapping the connection when it moves
+type resolvingTransport struct {
+	network  string
+	host     string
+	port     string
+	resolver Resolver
+	mu       sync.RWMutex
+	current  transport
+	// the IP the current transport is dialed to
+	ip   string
+	done chan bool
+	// closed once autoRefresh has returned
+	stopped   chan bool
+	closeOnce sync.Once
+	closeErr  error
+}
+
+func newResolvingTransport(network, address string, resolver Resolver, interval time.Duration) (*resolvingTransport, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	t := &resolvingTransport{
+		network:  network,
+		host:     host,
+		port:     port,
+		resolver: resolver,
+		done:     make(chan bool),
+		stopped:  make(chan bool),
+	}
+	if err := t.refresh(); err != nil {
+		return nil, err
+	}
+	go t.autoRefresh(interval)
+	return t, nil
+}
+
+func (t *resolvingTransport) autoRefresh(interval time.Duration) {
+	defer close(t.stopped)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			// on failure we keep sending to the last address that resolved
+			t.refresh()
+		case <-t.done:
+			return
+		}
+	}
+}
+
+// refresh resolves the host again and, if the address we are sending to is no
+// longer among the results, dials the new one and swaps it in. Buffered stats
+// live in Statistics so nothing is lost by the swap.
+func (t *resolvingTransport) refresh() error {
+	ctx, cancel := context.WithTimeout(context.Background(), dialTimeout)
+	defer cancel()
+	ips, err := t.resolver.LookupHost(ctx, t.host)
+	if err != nil {
+		return err
+	}
+	if len(ips) == 0 {
+		return errors.New("no addresses found for statsd host \"" + t.host + "\"")
+	}
+	t.mu.RLock()
+	current := t.ip
+	t.mu.RUnlock()
+	for _, ip := range ips {
+		if ip == current {
+			return nil
+		}
+	}
+	next, err := newTransport(t.network, net.JoinHostPort(ips[0], t.port))
+	if err != nil {
+		return err
+	}
+	t.mu.Lock()
+	previous := t.current
+	t.current = next
+	t.ip = ips[0]
+	t.mu.Unlock()
+	if previous != nil {
+		previous.Close()
+	}
+	return nil
+}
+
+func (t *resolvingTransport) Write(line []byte) error {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.current.Write(line)
+}
+
+// stops re-resolving and closes the current connection, closing again is a
+// no-op that returns the first result
+func (t *resolvingTransport) Close() error {
+	t.closeOnce.Do(func() {
+		close(t.done)
+		// a refresh in flight could otherwise dial after we closed
+		<-t.stopped
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		t.closeErr = t.current.Close()
+	})
+	return t.closeErr
+}
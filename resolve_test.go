@@ -0,0 +1,174 @@
+package gstats
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/franela/goblin"
+	. "github.com/onsi/gomega"
+)
+
+type fakeResolver struct {
+	mu    sync.Mutex
+	ips   []string
+	err   error
+	calls int
+}
+
+func (r *fakeResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls++
+	return r.ips, r.err
+}
+
+func (r *fakeResolver) set(ips []string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ips = ips
+	r.err = err
+}
+
+func (r *fakeResolver) lookups() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.calls
+}
+
+func helper_ReadUDP(sock *net.UDPConn) string {
+	buf := make([]byte, 1024)
+	sock.SetReadDeadline(time.Now().Add(time.Second))
+	readLength, _, err := sock.ReadFromUDP(buf)
+	if err != nil {
+		return ""
+	}
+	return string(buf[:readLength])
+}
+
+func TestResolve(t *testing.T) {
+	g := Goblin(t)
+	RegisterFailHandler(func(m string, _ ...int) { g.Fail(m) })
+	g.Describe("DNS re-resolution", func() {
+		var first, second *net.UDPConn
+		var port string
+		var resolver *fakeResolver
+		g.BeforeEach(func() {
+			var err error
+			first, err = net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+			Expect(err).NotTo(HaveOccurred())
+			port = strconv.Itoa(first.LocalAddr().(*net.UDPAddr).Port)
+			second, err = net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.2"), Port: first.LocalAddr().(*net.UDPAddr).Port})
+			Expect(err).NotTo(HaveOccurred())
+			resolver = &fakeResolver{ips: []string{"127.0.0.1"}}
+			os.Setenv("STATSD_PREFIX", "test")
+		})
+		g.AfterEach(func() {
+			first.Close()
+			second.Close()
+		})
+		g.It("should send to whatever the host resolved to at startup", func() {
+			stats, err := CreateStatsdClientWithOptions(Options{
+				Address:         "statsd.test:" + port,
+				ResolveInterval: time.Hour,
+				Resolver:        resolver,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stats.Inc("teststat")).NotTo(HaveOccurred())
+			Expect(helper_ReadUDP(first)).To(Equal("test.teststat.count:1|c"))
+		})
+		g.It("should fail fast when the host does not resolve at startup", func() {
+			resolver.set(nil, errors.New("no such host"))
+			_, err := CreateStatsdClientWithOptions(Options{
+				Address:         "statsd.test:" + port,
+				ResolveInterval: time.Hour,
+				Resolver:        resolver,
+			})
+			Expect(err).To(HaveOccurred())
+		})
+		g.It("should swap the connection when the host moves", func() {
+			stats, err := CreateStatsdClientWithOptions(Options{
+				Address:         "statsd.test:" + port,
+				ResolveInterval: time.Hour,
+				Resolver:        resolver,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			resolver.set([]string{"127.0.0.2"}, nil)
+			Expect(stats.filter.next.(*statsdClient).transport.(*resolvingTransport).refresh()).NotTo(HaveOccurred())
+			Expect(stats.Inc("teststat")).NotTo(HaveOccurred())
+			Expect(helper_ReadUDP(second)).To(Equal("test.teststat.count:1|c"))
+		})
+		g.It("should keep the current connection while it is still a valid answer", func() {
+			stats, err := CreateStatsdClientWithOptions(Options{
+				Address:         "statsd.test:" + port,
+				ResolveInterval: time.Hour,
+				Resolver:        resolver,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			resolving := stats.filter.next.(*statsdClient).transport.(*resolvingTransport)
+			current := resolving.current
+			resolver.set([]string{"127.0.0.2", "127.0.0.1"}, nil)
+			Expect(resolving.refresh()).NotTo(HaveOccurred())
+			Expect(resolving.current == current).To(BeTrue())
+		})
+		g.It("should keep sending to the old address when a lookup fails", func() {
+			stats, err := CreateStatsdClientWithOptions(Options{
+				Address:         "statsd.test:" + port,
+				ResolveInterval: time.Hour,
+				Resolver:        resolver,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			resolver.set(nil, errors.New("temporary failure"))
+			Expect(stats.filter.next.(*statsdClient).transport.(*resolvingTransport).refresh()).To(HaveOccurred())
+			Expect(stats.Inc("teststat")).NotTo(HaveOccurred())
+			Expect(helper_ReadUDP(first)).To(Equal("test.teststat.count:1|c"))
+		})
+		g.It("should re-resolve on the configured interval without losing buffered stats", func() {
+			stats, err := CreateStatsdClientWithOptions(Options{
+				Address:           "statsd.test:" + port,
+				BufferFlushPeriod: time.Hour,
+				ResolveInterval:   10 * time.Millisecond,
+				Resolver:          resolver,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stats.BufferedIncrementBy("buffered", 7)).NotTo(HaveOccurred())
+			resolver.set([]string{"127.0.0.2"}, nil)
+			lookups := resolver.lookups()
+			for resolver.lookups() < lookups+2 {
+				time.Sleep(5 * time.Millisecond)
+			}
+			stats.flushBufferedStats()
+			Expect(helper_ReadUDP(second)).To(Equal("test.buffered:7|c"))
+		})
+		g.It("should stop re-resolving once closed", func() {
+			stats, err := CreateStatsdClientWithOptions(Options{
+				Address:           "statsd.test:" + port,
+				BufferFlushPeriod: time.Hour,
+				ResolveInterval:   5 * time.Millisecond,
+				Resolver:          resolver,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stats.Close()).NotTo(HaveOccurred())
+			Expect(stats.Close()).NotTo(HaveOccurred())
+			lookups := resolver.lookups()
+			time.Sleep(30 * time.Millisecond)
+			Expect(resolver.lookups()).To(Equal(lookups))
+		})
+		g.It("should read the interval from STATSD_RESOLVE_INTERVAL", func() {
+			os.Setenv("STATSD_RESOLVE_INTERVAL", "not a duration")
+			defer os.Unsetenv("STATSD_RESOLVE_INTERVAL")
+			_, err := CreateStatsdClientWithOptions(Options{Address: "statsd.test:" + port, Resolver: resolver})
+			Expect(err).To(HaveOccurred())
+
+			os.Setenv("STATSD_RESOLVE_INTERVAL", "1h")
+			stats, err := CreateStatsdClientWithOptions(Options{Address: "statsd.test:" + port, Resolver: resolver})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stats.filter.next.(*statsdClient).transport).To(BeAssignableToTypeOf(&resolvingTransport{}))
+		})
+	})
+}
@@ -0,0 +1,236 @@
+package gstats
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// RoutingPolicy decides which of several statsd endpoints receives a stat
+type RoutingPolicy string
+
+const (
+	// send every stat to every endpoint, e.g. while migrating backends
+	RouteFanOut RoutingPolicy = "fanout"
+	// send to the first endpoint, moving down the list on send errors.
+	// Only stream transports (tcp, unix) report delivery errors.
+	RouteFailover RoutingPolicy = "failover"
+	// consistent-hash the stat name so the same stat always lands on the
+	// same aggregator
+	RouteHash RoutingPolicy = "hash"
+)
+
+// points each endpoint gets on the hash ring, more points spread stats more
+// evenly
+const hashRingReplicas = 128
+
+// splitAddresses turns a comma separated STATSD_ADDRESS into its endpoints
+func splitAddresses(address string) []string {
+	addresses := []string{}
+	for _, a := range strings.Split(address, ",") {
+		if a = strings.TrimSpace(a); a != "" {
+			addresses = append(addresses, a)
+		}
+	}
+	return addresses
+}
+
+func newSender(opts Options) (sender, error) {
+	addresses := splitAddresses(opts.Address)
+	if len(addresses) == 0 {
+		return nil, errors.New("no statsd address given")
+	}
+	switch opts.Routing {
+	case RouteFanOut, RouteFailover, RouteHash:
+	default:
+		return nil, errors.New("unknown statsd routing policy \"" + string(opts.Routing) + "\"")
+	}
+	clients := []*statsdClient{}
+	for _, address := range addresses {
+		endpoint := opts
+		endpoint.Address = address
+		client, err := newStatsdClient(endpoint)
+		if err != nil {
+			for _, c := range clients {
+				c.Close()
+			}
+			return nil, err
+		}
+		clients = append(clients, client)
+	}
+	if len(clients) == 1 {
+		return clients[0], nil
+	}
+	switch opts.Routing {
+	case RouteFanOut:
+		return &fanOutSender{clients}, nil
+	case RouteHash:
+		return newHashSender(addresses, clients), nil
+	}
+	return &failoverSender{clients}, nil
+}
+
+type fanOutSender struct {
+	clients []*statsdClient
+}
+
+// every endpoint is tried, the first error is returned
+func (s *fanOutSender) each(send func(*statsdClient) error) error {
+	var first error
+	for _, c := range s.clients {
+		if err := send(c); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+func (s *fanOutSender) Inc(stat string, value int64, rate float32) error {
+	return s.each(func(c *statsdClient) error { return c.Inc(stat, value, rate) })
+}
+
+func (s *fanOutSender) Gauge(stat string, value int64, rate float32) error {
+	return s.each(func(c *statsdClient) error { return c.Gauge(stat, value, rate) })
+}
+
+func (s *fanOutSender) Timing(stat string, delta int64, rate float32) error {
+	return s.each(func(c *statsdClient) error { return c.Timing(stat, delta, rate) })
+}
+
+func (s *fanOutSender) preciseTiming(stat string, milliseconds float64, tags string) error {
+	return s.each(func(c *statsdClient) error { return c.preciseTiming(stat, milliseconds, tags) })
+}
+
+func (s *fanOutSender) write(stat string, line []byte) error {
+	return s.each(func(c *statsdClient) error { return c.write(stat, line) })
+}
+
+func (s *fanOutSender) Close() error {
+	return s.each((*statsdClient).Close)
+}
+
+type failoverSender struct {
+	clients []*statsdClient
+}
+
+// endpoints are tried in order until one accepts the stat, the last error is
+// returned when none do
+func (s *failoverSender) first(send func(*statsdClient) error) error {
+	var err error
+	for _, c := range s.clients {
+		if err = send(c); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+func (s *failoverSender) Inc(stat string, value int64, rate float32) error {
+	return s.first(func(c *statsdClient) error { return c.Inc(stat, value, rate) })
+}
+
+func (s *failoverSender) Gauge(stat string, value int64, rate float32) error {
+	return s.first(func(c *statsdClient) error { return c.Gauge(stat, value, rate) })
+}
+
+func (s *failoverSender) Timing(stat string, delta int64, rate float32) error {
+	return s.first(func(c *statsdClient) error { return c.Timing(stat, delta, rate) })
+}
+
+func (s *failoverSender) preciseTiming(stat string, milliseconds float64, tags string) error {
+	return s.first(func(c *statsdClient) error { return c.preciseTiming(stat, milliseconds, tags) })
+}
+
+func (s *failoverSender) write(stat string, line []byte) error {
+	return s.first(func(c *statsdClient) error { return c.write(stat, line) })
+}
+
+func (s *failoverSender) Close() error {
+	return (&fanOutSender{s.clients}).each((*statsdClient).Close)
+}
+
+type hashSender struct {
+	clients []*statsdClient
+	// sorted hash ring points and the client owning each one
+	points []uint32
+	owners []*statsdClient
+}
+
+// endpoints are placed on the ring by address, so reordering STATSD_ADDRESS
+// does not move stats around and adding an endpoint only moves its share
+func newHashSender(addresses []string, clients []*statsdClient) *hashSender {
+	type point struct {
+		hash  uint32
+		owner *statsdClient
+	}
+	ring := []point{}
+	for i, address := range addresses {
+		for r := 0; r < hashRingReplicas; r++ {
+			ring = append(ring, point{ringHash(address + "#" + strconv.Itoa(r)), clients[i]})
+		}
+	}
+	sort.Slice(ring, func(i, j int) bool { return ring[i].hash < ring[j].hash })
+	s := &hashSender{clients: clients}
+	for _, p := range ring {
+		s.points = append(s.points, p.hash)
+		s.owners = append(s.owners, p.owner)
+	}
+	return s
+}
+
+// 32 bit FNV-1a, written out so hashing a stat name does not allocate
+func hashString(s string) uint32 {
+	h := uint32(2166136261)
+	for i := 0; i < len(s); i++ {
+		h ^= uint32(s[i])
+		h *= 16777619
+	}
+	return h
+}
+
+// FNV-1a barely moves the high bits for names that only differ at the end,
+// like "stat1" and "stat2" or "host:8125#1" and "host:8125#2", so its output
+// is mixed (the murmur3 finalizer) before it is placed on the ring
+func ringHash(s string) uint32 {
+	h := hashString(s)
+	h ^= h >> 16
+	h *= 0x85ebca6b
+	h ^= h >> 13
+	h *= 0xc2b2ae35
+	h ^= h >> 16
+	return h
+}
+
+func (s *hashSender) pick(stat string) *statsdClient {
+	h := ringHash(stat)
+	i := sort.Search(len(s.points), func(i int) bool { return s.points[i] >= h })
+	if i == len(s.points) {
+		i = 0
+	}
+	return s.owners[i]
+}
+
+func (s *hashSender) Inc(stat string, value int64, rate float32) error {
+	return s.pick(stat).Inc(stat, value, rate)
+}
+
+func (s *hashSender) Gauge(stat string, value int64, rate float32) error {
+	return s.pick(stat).Gauge(stat, value, rate)
+}
+
+func (s *hashSender) Timing(stat string, delta int64, rate float32) error {
+	return s.pick(stat).Timing(stat, delta, rate)
+}
+
+func (s *hashSender) preciseTiming(stat string, milliseconds float64, tags string) error {
+	return s.pick(stat).preciseTiming(stat, milliseconds, tags)
+}
+
+func (s *hashSender) write(stat string, line []byte) error {
+	return s.pick(stat).write(stat, line)
+}
+
+func (s *hashSender) Close() error {
+	return (&fanOutSender{s.clients}).each((*statsdClient).Close)
+}
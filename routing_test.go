@@ -0,0 +1,117 @@
+package gstats
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"testing"
+
+	. "github.com/franela/goblin"
+	. "github.com/onsi/gomega"
+)
+
+func TestRouting(t *testing.T) {
+	g := Goblin(t)
+	RegisterFailHandler(func(m string, _ ...int) { g.Fail(m) })
+	g.Describe("Address lists", func() {
+		g.It("should split comma separated addresses", func() {
+			Expect(splitAddresses("127.0.0.1:8125, tcp://relay:8125,,")).To(Equal([]string{"127.0.0.1:8125", "tcp://relay:8125"}))
+		})
+	})
+	g.Describe("Routing", func() {
+		var first, second *net.UDPConn
+		var addresses string
+		g.BeforeEach(func() {
+			var err error
+			first, err = net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+			Expect(err).NotTo(HaveOccurred())
+			second, err = net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+			Expect(err).NotTo(HaveOccurred())
+			addresses = first.LocalAddr().String() + "," + second.LocalAddr().String()
+			os.Setenv("STATSD_ADDRESS", addresses)
+			os.Setenv("STATSD_PREFIX", "test")
+		})
+		g.AfterEach(func() {
+			first.Close()
+			second.Close()
+			os.Unsetenv("STATSD_ROUTING")
+		})
+		g.It("should send every stat to every endpoint when fanning out", func() {
+			os.Setenv("STATSD_ROUTING", "fanout")
+			stats, err := CreateStatsdClient()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stats.Inc("teststat")).NotTo(HaveOccurred())
+			Expect(helper_ReadUDP(first)).To(Equal("test.teststat.count:1|c"))
+			Expect(helper_ReadUDP(second)).To(Equal("test.teststat.count:1|c"))
+		})
+		g.It("should fail over to the next endpoint on send errors", func() {
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).NotTo(HaveOccurred())
+			deadPrimary := "tcp://" + listener.Addr().String()
+			listener.Close()
+
+			stats, err := CreateStatsdClientWithOptions(Options{
+				Address: deadPrimary + "," + second.LocalAddr().String(),
+				Routing: RouteFailover,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stats.Inc("teststat")).NotTo(HaveOccurred())
+			Expect(helper_ReadUDP(second)).To(Equal("test.teststat.count:1|c"))
+		})
+		g.It("should only use the primary while it works", func() {
+			stats, err := CreateStatsdClientWithOptions(Options{Routing: RouteFailover})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stats.Inc("teststat")).NotTo(HaveOccurred())
+			Expect(helper_ReadUDP(first)).To(Equal("test.teststat.count:1|c"))
+			Expect(stats.filter.next.(*failoverSender).clients).To(HaveLen(2))
+		})
+		g.It("should always send the same stat to the same endpoint when hashing", func() {
+			stats, err := CreateStatsdClientWithOptions(Options{Routing: RouteHash})
+			Expect(err).NotTo(HaveOccurred())
+			hashed := stats.filter.next.(*hashSender)
+			owners := map[*statsdClient]int{}
+			for i := 0; i < 100; i++ {
+				stat := "stat" + strconv.Itoa(i)
+				owner := hashed.pick(stat)
+				Expect(hashed.pick(stat) == owner).To(BeTrue())
+				owners[owner]++
+			}
+			Expect(owners).To(HaveLen(2))
+
+			owner := hashed.pick("teststat.count")
+			Expect(stats.Inc("teststat")).NotTo(HaveOccurred())
+			if owner == hashed.clients[0] {
+				Expect(helper_ReadUDP(first)).To(Equal("test.teststat.count:1|c"))
+			} else {
+				Expect(helper_ReadUDP(second)).To(Equal("test.teststat.count:1|c"))
+			}
+		})
+		g.It("should spread similar stat names over every endpoint", func() {
+			for port := 30000; port < 30500; port++ {
+				addresses := []string{"127.0.0.1:" + strconv.Itoa(port), "127.0.0.1:" + strconv.Itoa(port+10000)}
+				clients := []*statsdClient{{prefix: addresses[0]}, {prefix: addresses[1]}}
+				owners := map[*statsdClient]int{}
+				hashed := newHashSender(addresses, clients)
+				for i := 0; i < 100; i++ {
+					owners[hashed.pick("stat"+strconv.Itoa(i))]++
+				}
+				Expect(owners[clients[0]]).To(BeNumerically(">=", 20))
+				Expect(owners[clients[1]]).To(BeNumerically(">=", 20))
+			}
+		})
+		g.It("should not move stats when the address list is reordered", func() {
+			forward := splitAddresses(addresses)
+			backward := []string{forward[1], forward[0]}
+			a := newHashSender(forward, []*statsdClient{{prefix: forward[0]}, {prefix: forward[1]}})
+			b := newHashSender(backward, []*statsdClient{{prefix: backward[0]}, {prefix: backward[1]}})
+			for i := 0; i < 100; i++ {
+				stat := "stat" + strconv.Itoa(i)
+				Expect(a.pick(stat).prefix).To(Equal(b.pick(stat).prefix))
+			}
+		})
+		g.It("should reject unknown routing policies", func() {
+			_, err := CreateStatsdClientWithOptions(Options{Routing: "roundrobin"})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+}
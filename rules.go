@@ -0,0 +1,277 @@
+package gstats
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Rules rewrite and filter stat names before they are sent. They are read
+// top to bottom, one per line, blank lines and lines starting with # are
+// ignored:
+//
+//	rename legacy.api.*      api.v1.*   # * and ? in the new name refer to the old one
+//	rename re:^svc\.(\w+)\.  $1.       # regexps start with re: and use $1 style groups
+//	allow  api.*                       # stop here and send the stat
+//	deny   debug.*                     # stop here and drop the stat
+//
+// renames change the name seen by the rules below them, the first allow or
+// deny that matches decides, and stats that match neither are sent. End with
+// "deny *" to only send what was allowed.
+type Rules struct {
+	rules []rule
+}
+
+type rule struct {
+	action  string
+	pattern *pattern
+	// regexp template for renames
+	replacement string
+}
+
+// a glob or, when prefixed with re:, a regular expression
+type pattern struct {
+	source string
+	re     *regexp.Regexp
+}
+
+func compilePattern(source string) (*pattern, error) {
+	if strings.HasPrefix(source, "re:") {
+		re, err := regexp.Compile(source[len("re:"):])
+		if err != nil {
+			return nil, err
+		}
+		return &pattern{source, re}, nil
+	}
+	// globs match the whole name, every wildcard is captured so renames
+	// can refer back to it
+	expr := "^"
+	for _, r := range source {
+		switch r {
+		case '*':
+			expr += "(.*)"
+		case '?':
+			expr += "(.)"
+		default:
+			expr += regexp.QuoteMeta(string(r))
+		}
+	}
+	return &pattern{source, regexp.MustCompile(expr + "$")}, nil
+}
+
+func (p *pattern) match(stat string) bool {
+	return p.re.MatchString(stat)
+}
+
+// globReplacement turns the * and ? of a glob rename target into references
+// to the wildcards the source pattern captured, in order
+func globReplacement(target string) string {
+	replacement := ""
+	group := 0
+	for _, r := range target {
+		switch r {
+		case '*', '?':
+			group++
+			replacement += "${" + strconv.Itoa(group) + "}"
+		case '$':
+			replacement += "$$"
+		default:
+			replacement += string(r)
+		}
+	}
+	return replacement
+}
+
+// ParseRules reads rules in the format described on Rules
+func ParseRules(r io.Reader) (*Rules, error) {
+	rules := &Rules{}
+	scanner := bufio.NewScanner(r)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		parsed, err := parseRule(fields)
+		if err != nil {
+			return nil, errors.New("rules line " + strconv.Itoa(lineNumber) + ": " + err.Error())
+		}
+		rules.rules = append(rules.rules, parsed)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+func parseRule(fields []string) (rule, error) {
+	switch fields[0] {
+	case "allow", "deny":
+		if len(fields) != 2 {
+			return rule{}, errors.New(fields[0] + " takes one pattern")
+		}
+		p, err := compilePattern(fields[1])
+		if err != nil {
+			return rule{}, err
+		}
+		return rule{action: fields[0], pattern: p}, nil
+	case "rename":
+		if len(fields) != 3 {
+			return rule{}, errors.New("rename takes a pattern and a new name")
+		}
+		p, err := compilePattern(fields[1])
+		if err != nil {
+			return rule{}, err
+		}
+		replacement := fields[2]
+		if !strings.HasPrefix(fields[1], "re:") {
+			replacement = globReplacement(replacement)
+		}
+		return rule{action: "rename", pattern: p, replacement: replacement}, nil
+	}
+	return rule{}, errors.New("unknown action \"" + fields[0] + "\"")
+}
+
+// LoadRules reads rules from a file, see Rules for the format
+func LoadRules(path string) (*Rules, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseRules(f)
+}
+
+// Apply returns the name the stat should be sent as, or false if it should
+// be dropped
+func (r *Rules) Apply(stat string) (string, bool) {
+	if r == nil {
+		return stat, true
+	}
+	for _, rule := range r.rules {
+		if !rule.pattern.match(stat) {
+			continue
+		}
+		switch rule.action {
+		case "rename":
+			stat = rule.pattern.re.ReplaceAllString(stat, rule.replacement)
+		case "allow":
+			return stat, true
+		case "deny":
+			return stat, false
+		}
+	}
+	return stat, true
+}
+
+// applies Rules and dropped families to everything on its way to the wire,
+// which covers every Statistics method as well as buffered flushes
+type ruleSender struct {
+	next    sender
+	mu      sync.RWMutex
+	rules   *Rules
+	dropped []*pattern
+	// bumped whenever rules or dropped change, so handles know to apply
+	// them again
+	version atomic.Uint64
+}
+
+// callers must not hold f.mu
+func (f *ruleSender) apply(stat string) (string, bool) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	for _, p := range f.dropped {
+		if p.match(stat) {
+			return stat, false
+		}
+	}
+	return f.rules.Apply(stat)
+}
+
+func (f *ruleSender) Inc(stat string, value int64, rate float32) error {
+	if stat, ok := f.apply(stat); ok {
+		return f.next.Inc(stat, value, rate)
+	}
+	return nil
+}
+
+func (f *ruleSender) Gauge(stat string, value int64, rate float32) error {
+	if stat, ok := f.apply(stat); ok {
+		return f.next.Gauge(stat, value, rate)
+	}
+	return nil
+}
+
+func (f *ruleSender) Timing(stat string, delta int64, rate float32) error {
+	if stat, ok := f.apply(stat); ok {
+		return f.next.Timing(stat, delta, rate)
+	}
+	return nil
+}
+
+func (f *ruleSender) preciseTiming(stat string, milliseconds float64, tags string) error {
+	if stat, ok := f.apply(stat); ok {
+		return f.next.preciseTiming(stat, milliseconds, tags)
+	}
+	return nil
+}
+
+// lines handed to write were built by a handle that has already applied the
+// rules, see boundStat
+func (f *ruleSender) write(stat string, line []byte) error {
+	return f.next.write(stat, line)
+}
+
+func (f *ruleSender) Close() error {
+	return f.next.Close()
+}
+
+// stats.SetRules(rules) replaces the rules every stat is run through, nil
+// sends everything unchanged
+func (s *Statistics) SetRules(rules *Rules) {
+	s.filter.mu.Lock()
+	defer s.filter.mu.Unlock()
+	s.filter.rules = rules
+	s.filter.version.Add(1)
+}
+
+// stats.DropFamily("debug.*") stops sending matching stats until
+// RestoreFamily is called with the same pattern, e.g. while a backend is
+// overloaded. Dropped families are checked before the rules.
+func (s *Statistics) DropFamily(family string) error {
+	p, err := compilePattern(family)
+	if err != nil {
+		return err
+	}
+	s.filter.mu.Lock()
+	defer s.filter.mu.Unlock()
+	for _, dropped := range s.filter.dropped {
+		if dropped.source == family {
+			return nil
+		}
+	}
+	s.filter.dropped = append(s.filter.dropped, p)
+	s.filter.version.Add(1)
+	return nil
+}
+
+func (s *Statistics) RestoreFamily(family string) {
+	s.filter.mu.Lock()
+	defer s.filter.mu.Unlock()
+	for i, dropped := range s.filter.dropped {
+		if dropped.source == family {
+			s.filter.dropped = append(s.filter.dropped[:i], s.filter.dropped[i+1:]...)
+			s.filter.version.Add(1)
+			return
+		}
+	}
+}
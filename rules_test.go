@@ -0,0 +1,136 @@
+package gstats
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/franela/goblin"
+	. "github.com/onsi/gomega"
+)
+
+func helper_ParseRules(text string) *Rules {
+	rules, err := ParseRules(strings.NewReader(text))
+	Expect(err).NotTo(HaveOccurred())
+	return rules
+}
+
+func TestRules(t *testing.T) {
+	g := Goblin(t)
+	RegisterFailHandler(func(m string, _ ...int) { g.Fail(m) })
+	g.Describe("Rules", func() {
+		g.It("should send everything when there are no rules", func() {
+			var rules *Rules
+			stat, ok := rules.Apply("anything.at.all")
+			Expect(ok).To(BeTrue())
+			Expect(stat).To(Equal("anything.at.all"))
+		})
+		g.It("should let the first allow or deny decide", func() {
+			rules := helper_ParseRules(`
+				# keep the api stats, drop the rest of the debug noise
+				allow debug.api.*
+				deny  debug.*
+			`)
+			_, ok := rules.Apply("debug.api.latency")
+			Expect(ok).To(BeTrue())
+			_, ok = rules.Apply("debug.cache.size")
+			Expect(ok).To(BeFalse())
+			_, ok = rules.Apply("api.requests")
+			Expect(ok).To(BeTrue())
+		})
+		g.It("should only send allowed stats when ending with deny *", func() {
+			rules := helper_ParseRules("allow api.*\ndeny *\n")
+			_, ok := rules.Apply("api.requests")
+			Expect(ok).To(BeTrue())
+			_, ok = rules.Apply("db.queries")
+			Expect(ok).To(BeFalse())
+		})
+		g.It("should rename with globs", func() {
+			rules := helper_ParseRules("rename legacy.api.* api.v1.*")
+			stat, ok := rules.Apply("legacy.api.users.get")
+			Expect(ok).To(BeTrue())
+			Expect(stat).To(Equal("api.v1.users.get"))
+			stat, _ = rules.Apply("legacy.web.users")
+			Expect(stat).To(Equal("legacy.web.users"))
+		})
+		g.It("should rename with regular expressions", func() {
+			rules := helper_ParseRules(`rename re:^svc\.(\w+)\. $1.`)
+			stat, _ := rules.Apply("svc.billing.invoices.count")
+			Expect(stat).To(Equal("billing.invoices.count"))
+		})
+		g.It("should match later rules against the renamed stat", func() {
+			rules := helper_ParseRules("rename old.* new.*\ndeny new.secret")
+			_, ok := rules.Apply("old.secret")
+			Expect(ok).To(BeFalse())
+		})
+		g.It("should treat glob characters literally everywhere else", func() {
+			rules := helper_ParseRules("deny a.b")
+			_, ok := rules.Apply("aXb")
+			Expect(ok).To(BeTrue())
+		})
+		g.It("should report malformed rules with their line number", func() {
+			_, err := ParseRules(strings.NewReader("allow a.*\nexplode b.*\n"))
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("line 2"))
+			_, err = ParseRules(strings.NewReader("rename a.*"))
+			Expect(err).To(HaveOccurred())
+			_, err = ParseRules(strings.NewReader("deny re:(unclosed"))
+			Expect(err).To(HaveOccurred())
+		})
+	})
+	g.Describe("Statistics with rules", func() {
+		var sock *net.UDPConn
+		g.BeforeEach(func() {
+			var err error
+			sock, err = net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+			Expect(err).NotTo(HaveOccurred())
+			os.Setenv("STATSD_ADDRESS", sock.LocalAddr().String())
+			os.Setenv("STATSD_PREFIX", "test")
+		})
+		g.AfterEach(func() {
+			sock.Close()
+			os.Unsetenv("STATSD_RULES_FILE")
+		})
+		g.It("should load rules from STATSD_RULES_FILE", func() {
+			dir, err := os.MkdirTemp("", "gstats")
+			Expect(err).NotTo(HaveOccurred())
+			defer os.RemoveAll(dir)
+			path := filepath.Join(dir, "rules")
+			Expect(os.WriteFile(path, []byte("rename legacy.* modern.*\n"), 0644)).NotTo(HaveOccurred())
+			os.Setenv("STATSD_RULES_FILE", path)
+
+			stats, err := CreateStatsdClient()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stats.Gauge("legacy.queue", 3)).NotTo(HaveOccurred())
+			Expect(helper_ReadUDP(sock)).To(Equal("test.modern.queue:3|g"))
+		})
+		g.It("should fail fast on a broken rules file", func() {
+			os.Setenv("STATSD_RULES_FILE", "/nonexistent/rules")
+			_, err := CreateStatsdClient()
+			Expect(err).To(HaveOccurred())
+		})
+		g.It("should apply rules to buffered flushes", func() {
+			stats, err := _CreateStatsdClient(time.Hour)
+			Expect(err).NotTo(HaveOccurred())
+			stats.SetRules(helper_ParseRules("rename legacy.* modern.*"))
+			Expect(stats.BufferedIncrementBy("legacy.requests", 4)).NotTo(HaveOccurred())
+			stats.flushBufferedStats()
+			Expect(helper_ReadUDP(sock)).To(Equal("test.modern.requests:4|c"))
+		})
+		g.It("should drop and restore families at runtime", func() {
+			stats, err := CreateStatsdClient()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stats.DropFamily("debug.*")).NotTo(HaveOccurred())
+			Expect(stats.Inc("debug.cache")).NotTo(HaveOccurred())
+			Expect(stats.Inc("api")).NotTo(HaveOccurred())
+			Expect(helper_ReadUDP(sock)).To(Equal("test.api.count:1|c"))
+
+			stats.RestoreFamily("debug.*")
+			Expect(stats.Inc("debug.cache")).NotTo(HaveOccurred())
+			Expect(helper_ReadUDP(sock)).To(Equal("test.debug.cache.count:1|c"))
+		})
+	})
+}
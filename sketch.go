@@ -0,0 +1,298 @@
+package gstats
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// quantiles reported by a Sketch are within this fraction of the true value
+const sketchRelativeAccuracy = 0.01
+
+var (
+	sketchGamma    = (1 + sketchRelativeAccuracy) / (1 - sketchRelativeAccuracy)
+	sketchLogGamma = math.Log(sketchGamma)
+)
+
+// Sketch is a mergeable histogram of non-negative values. Values are kept in
+// logarithmically sized buckets, so any quantile is answered to within 1% of
+// the real value no matter how many samples were added. A Sketch is not safe
+// for concurrent use.
+type Sketch struct {
+	bins  map[int]uint64
+	zeros uint64
+	count uint64
+	sum   float64
+	min   float64
+	max   float64
+}
+
+func NewSketch() *Sketch {
+	return &Sketch{bins: make(map[int]uint64)}
+}
+
+// negative values are counted as zero
+func (s *Sketch) Add(value float64) {
+	if s.count == 0 || value < s.min {
+		s.min = value
+	}
+	if s.count == 0 || value > s.max {
+		s.max = value
+	}
+	s.count++
+	s.sum += value
+	if value <= 0 {
+		s.zeros++
+		return
+	}
+	s.bins[int(math.Ceil(math.Log(value)/sketchLogGamma))]++
+}
+
+// Merge adds every sample in other to s
+func (s *Sketch) Merge(other *Sketch) {
+	if other.count == 0 {
+		return
+	}
+	if s.count == 0 || other.min < s.min {
+		s.min = other.min
+	}
+	if s.count == 0 || other.max > s.max {
+		s.max = other.max
+	}
+	s.count += other.count
+	s.sum += other.sum
+	s.zeros += other.zeros
+	for bin, n := range other.bins {
+		s.bins[bin] += n
+	}
+}
+
+func (s *Sketch) Copy() *Sketch {
+	c := NewSketch()
+	c.Merge(s)
+	return c
+}
+
+func (s *Sketch) Count() uint64 {
+	return s.count
+}
+
+func (s *Sketch) Min() float64 {
+	return s.min
+}
+
+func (s *Sketch) Max() float64 {
+	return s.max
+}
+
+func (s *Sketch) Mean() float64 {
+	if s.count == 0 {
+		return 0
+	}
+	return s.sum / float64(s.count)
+}
+
+// Quantile returns the value below which a fraction q of the samples fall,
+// Quantile(0.99) is the p99
+func (s *Sketch) Quantile(q float64) float64 {
+	if s.count == 0 {
+		return 0
+	}
+	rank := uint64(q * float64(s.count-1))
+	if rank < s.zeros {
+		return 0
+	}
+	seen := s.zeros
+	bins := make([]int, 0, len(s.bins))
+	for bin := range s.bins {
+		bins = append(bins, bin)
+	}
+	sort.Ints(bins)
+	for _, bin := range bins {
+		seen += s.bins[bin]
+		if seen > rank {
+			// the middle of the bucket, in relative terms
+			value := 2 * math.Pow(sketchGamma, float64(bin)) / (sketchGamma + 1)
+			return math.Max(s.min, math.Min(s.max, value))
+		}
+	}
+	return s.max
+}
+
+// SketchPolicy keeps an in-process Sketch of a timer's samples, so
+// percentiles do not depend on every sample surviving the trip to statsd.
+// At every flush the quantiles, the number of samples and the largest sample
+// of the past interval are sent as gauges: "stat.p50", "stat.p99",
+// "stat.samples", "stat.max".
+type SketchPolicy struct {
+	// e.g. 0.5, 0.99, 0.999
+	Quantiles []float64
+	// keep sending every sample to statsd as a timer too
+	SendSamples bool
+}
+
+type sketchRule struct {
+	pattern string
+	policy  SketchPolicy
+}
+
+type timerSketch struct {
+	policy SketchPolicy
+	// samples since the last flush
+	interval *Sketch
+	// samples from every flushed interval, for Snapshots
+	total *Sketch
+}
+
+// stats.SetSketchPolicy("db.*", gstats.SketchPolicy{Quantiles: []float64{0.5, 0.99}})
+// patterns use path.Match syntax and the first registered match wins
+func (s *Statistics) SetSketchPolicy(pattern string, policy SketchPolicy) error {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return err
+	}
+	for _, q := range policy.Quantiles {
+		if q < 0 || q > 1 {
+			return errors.New("quantile " + strconv.FormatFloat(q, 'f', -1, 64) + " is not between 0 and 1")
+		}
+	}
+	s.sketchMu.Lock()
+	defer s.sketchMu.Unlock()
+	replaced := false
+	for i, rule := range s.sketchRules {
+		if rule.pattern == pattern {
+			s.sketchRules[i].policy = policy
+			replaced = true
+		}
+	}
+	if !replaced {
+		s.sketchRules = append(s.sketchRules, sketchRule{pattern, policy})
+	}
+	// stats that are already sketched keep their samples
+	for stat, sketch := range s.sketches {
+		if current, ok := s.sketchPolicy(stat); ok {
+			sketch.policy = current
+		}
+	}
+	s.sketching.Store(true)
+	return nil
+}
+
+// callers must hold s.sketchMu
+func (s *Statistics) sketchPolicy(stat string) (SketchPolicy, bool) {
+	for _, rule := range s.sketchRules {
+		if matched, _ := path.Match(rule.pattern, stat); matched {
+			return rule.policy, true
+		}
+	}
+	return SketchPolicy{}, false
+}
+
+// records a timer sample if the stat is sketched, and reports whether the
+// sample should still be sent to statsd. Until the first SetSketchPolicy this
+// takes no lock at all.
+func (s *Statistics) sketchSample(stat string, milliseconds float64) bool {
+	if !s.sketching.Load() {
+		return true
+	}
+	s.sketchMu.Lock()
+	defer s.sketchMu.Unlock()
+	sketch, ok := s.sketches[stat]
+	if !ok {
+		policy, ok := s.sketchPolicy(stat)
+		if !ok {
+			return true
+		}
+		sketch = &timerSketch{policy, NewSketch(), NewSketch()}
+		s.sketches[stat] = sketch
+	}
+	sketch.interval.Add(milliseconds)
+	return sketch.policy.SendSamples
+}
+
+// the intervals are swapped out under s.sketchMu and sent once it is released,
+// so timers never wait on the network
+func (s *Statistics) flushSketches() {
+	type flushed struct {
+		stat     string
+		policy   SketchPolicy
+		interval *Sketch
+	}
+	due := []flushed{}
+	s.sketchMu.Lock()
+	for stat, sketch := range s.sketches {
+		if sketch.interval.Count() == 0 {
+			continue
+		}
+		due = append(due, flushed{stat, sketch.policy, sketch.interval})
+		sketch.total.Merge(sketch.interval)
+		sketch.interval = NewSketch()
+	}
+	s.sketchMu.Unlock()
+	for _, f := range due {
+		for _, q := range f.policy.Quantiles {
+			s.client.Gauge(f.stat+"."+quantileName(q), int64(math.Round(f.interval.Quantile(q))), 1.0)
+		}
+		s.client.Gauge(f.stat+".samples", int64(f.interval.Count()), 1.0)
+		s.client.Gauge(f.stat+".max", int64(math.Round(f.interval.Max())), 1.0)
+	}
+}
+
+// 0.5 => "p50", 0.07 => "p07", 0.999 => "p999". The name is made from the
+// decimal digits of q, q*100 is not exact for values like 0.07 or 0.29.
+func quantileName(q float64) string {
+	if q <= 0 {
+		return "p0"
+	}
+	if q >= 1 {
+		return "p100"
+	}
+	digits := strings.TrimPrefix(strconv.FormatFloat(q, 'f', -1, 64), "0.")
+	if len(digits) < 2 {
+		digits += "0"
+	}
+	return "p" + digits
+}
+
+// Snapshots returns a copy of every sketch, holding all samples since the
+// client started. Sketches from several processes can be combined with Merge.
+func (s *Statistics) Snapshots() map[string]*Sketch {
+	s.sketchMu.Lock()
+	defer s.sketchMu.Unlock()
+	snapshots := make(map[string]*Sketch, len(s.sketches))
+	for stat, sketch := range s.sketches {
+		snapshot := sketch.total.Copy()
+		snapshot.Merge(sketch.interval)
+		snapshots[stat] = snapshot
+	}
+	return snapshots
+}
+
+type sketchSummary struct {
+	Count     uint64             `json:"count"`
+	Min       float64            `json:"min"`
+	Max       float64            `json:"max"`
+	Mean      float64            `json:"mean"`
+	Quantiles map[string]float64 `json:"quantiles"`
+}
+
+// SketchHandler serves Snapshots as JSON, for mounting on a debug mux
+// > http.Handle("/debug/gstats/sketches", stats.SketchHandler())
+func (s *Statistics) SketchHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		summaries := map[string]sketchSummary{}
+		for stat, snapshot := range s.Snapshots() {
+			quantiles := map[string]float64{}
+			for _, q := range []float64{0.5, 0.9, 0.95, 0.99, 0.999} {
+				quantiles[quantileName(q)] = snapshot.Quantile(q)
+			}
+			summaries[stat] = sketchSummary{snapshot.Count(), snapshot.Min(), snapshot.Max(), snapshot.Mean(), quantiles}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(summaries)
+	})
+}
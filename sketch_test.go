@@ -0,0 +1,165 @@
+package gstats
+
+import (
+	"encoding/json"
+	"math"
+	"math/rand"
+	"net"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"testing"
+	"time"
+
+	. "github.com/franela/goblin"
+	. "github.com/onsi/gomega"
+)
+
+func TestSketch(t *testing.T) {
+	g := Goblin(t)
+	RegisterFailHandler(func(m string, _ ...int) { g.Fail(m) })
+	g.Describe("Sketch", func() {
+		g.It("should answer quantiles within its relative accuracy", func() {
+			sketch := NewSketch()
+			values := []float64{}
+			r := rand.New(rand.NewSource(1))
+			for i := 0; i < 10000; i++ {
+				// long tailed, like real latencies
+				v := math.Exp(r.NormFloat64()*1.5 + 3)
+				values = append(values, v)
+				sketch.Add(v)
+			}
+			sort.Float64s(values)
+			for _, q := range []float64{0.5, 0.9, 0.99, 0.999} {
+				exact := values[int(q*float64(len(values)-1))]
+				Expect(math.Abs(sketch.Quantile(q)-exact) / exact).To(BeNumerically("<=", sketchRelativeAccuracy+1e-9))
+			}
+			Expect(sketch.Count()).To(Equal(uint64(10000)))
+			Expect(sketch.Max()).To(Equal(values[len(values)-1]))
+			Expect(sketch.Min()).To(Equal(values[0]))
+		})
+		g.It("should handle zeros and empty sketches", func() {
+			sketch := NewSketch()
+			Expect(sketch.Quantile(0.99)).To(Equal(0.0))
+			Expect(sketch.Mean()).To(Equal(0.0))
+			sketch.Add(0)
+			sketch.Add(0)
+			sketch.Add(10)
+			Expect(sketch.Quantile(0.5)).To(Equal(0.0))
+			Expect(sketch.Quantile(1)).To(BeNumerically("~", 10, 0.1))
+		})
+		g.It("should merge into the same sketch as adding everything to one", func() {
+			whole, left, right := NewSketch(), NewSketch(), NewSketch()
+			for i := 1; i <= 1000; i++ {
+				whole.Add(float64(i))
+				if i%2 == 0 {
+					left.Add(float64(i))
+				} else {
+					right.Add(float64(i))
+				}
+			}
+			left.Merge(right)
+			Expect(left.Count()).To(Equal(whole.Count()))
+			Expect(left.Mean()).To(Equal(whole.Mean()))
+			for _, q := range []float64{0.1, 0.5, 0.99} {
+				Expect(left.Quantile(q)).To(Equal(whole.Quantile(q)))
+			}
+		})
+		g.It("should name quantiles the way dashboards expect", func() {
+			Expect(quantileName(0.5)).To(Equal("p50"))
+			Expect(quantileName(0.99)).To(Equal("p99"))
+			Expect(quantileName(0.999)).To(Equal("p999"))
+			Expect(quantileName(0.07)).To(Equal("p07"))
+			Expect(quantileName(0.29)).To(Equal("p29"))
+			Expect(quantileName(0.57)).To(Equal("p57"))
+			Expect(quantileName(0.9)).To(Equal("p90"))
+			Expect(quantileName(1)).To(Equal("p100"))
+		})
+	})
+	g.Describe("Sketched timers", func() {
+		var sock *net.UDPConn
+		var stats *Statistics
+		var clock *FakeClock
+		g.BeforeEach(func() {
+			var err error
+			sock, err = net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+			Expect(err).NotTo(HaveOccurred())
+			os.Setenv("STATSD_ADDRESS", sock.LocalAddr().String())
+			os.Setenv("STATSD_PREFIX", "test")
+			clock = NewFakeClock(time.Now())
+			stats, err = CreateStatsdClientWithOptions(Options{Clock: clock, BufferFlushPeriod: time.Hour})
+			Expect(err).NotTo(HaveOccurred())
+		})
+		g.AfterEach(func() {
+			sock.Close()
+		})
+		g.It("should reject malformed policies", func() {
+			Expect(stats.SetSketchPolicy("[", SketchPolicy{})).To(HaveOccurred())
+			Expect(stats.SetSketchPolicy("db.*", SketchPolicy{Quantiles: []float64{99}})).To(HaveOccurred())
+		})
+		g.It("should send quantiles, count and max as gauges on flush instead of every sample", func() {
+			Expect(stats.SetSketchPolicy("db.*", SketchPolicy{Quantiles: []float64{0.5, 0.99}})).NotTo(HaveOccurred())
+			for i := 1; i <= 100; i++ {
+				name, start, inc := stats.Trace("db.query")
+				clock.Advance(time.Duration(i) * time.Millisecond)
+				stats.End(name, start, inc)
+			}
+			stats.Flush()
+			Expect(helper_ReadUDP(sock)).To(Equal("test.db.query.p50:50|g"))
+			Expect(helper_ReadUDP(sock)).To(Equal("test.db.query.p99:99|g"))
+			Expect(helper_ReadUDP(sock)).To(Equal("test.db.query.samples:100|g"))
+			Expect(helper_ReadUDP(sock)).To(Equal("test.db.query.max:100|g"))
+
+			// the interval starts over
+			stats.Flush()
+			sock.SetReadDeadline(time.Now().Add(20 * time.Millisecond))
+			_, _, err := sock.ReadFromUDP(make([]byte, 1024))
+			Expect(err).To(HaveOccurred())
+		})
+		g.It("should keep sending samples when asked to", func() {
+			Expect(stats.SetSketchPolicy("db.*", SketchPolicy{SendSamples: true})).NotTo(HaveOccurred())
+			name, start, inc := stats.Trace("db.query")
+			clock.Advance(7 * time.Millisecond)
+			stats.BufferedEnd(name, start, inc)
+			Expect(helper_ReadUDP(sock)).To(Equal("test.db.query:7|ms"))
+			stats.Flush()
+			Expect(helper_ReadUDP(sock)).To(Equal("test.db.query.samples:1|g"))
+		})
+		g.It("should sketch timer handles too", func() {
+			Expect(stats.SetSketchPolicy("db.*", SketchPolicy{Quantiles: []float64{0.5}})).NotTo(HaveOccurred())
+			Expect(stats.Timer("db.query").Record(12 * time.Millisecond)).NotTo(HaveOccurred())
+			stats.Flush()
+			Expect(helper_ReadUDP(sock)).To(Equal("test.db.query.p50:12|g"))
+			Expect(helper_ReadUDP(sock)).To(Equal("test.db.query.samples:1|g"))
+		})
+		g.It("should leave other timers alone", func() {
+			Expect(stats.SetSketchPolicy("db.*", SketchPolicy{Quantiles: []float64{0.5}})).NotTo(HaveOccurred())
+			name, start, inc := stats.Trace("http.request")
+			clock.Advance(3 * time.Millisecond)
+			stats.End(name, start, inc)
+			Expect(helper_ReadUDP(sock)).To(Equal("test.http.request:3|ms"))
+			Expect(stats.Snapshots()).To(BeEmpty())
+		})
+		g.It("should serve snapshots of everything seen so far", func() {
+			Expect(stats.SetSketchPolicy("db.*", SketchPolicy{Quantiles: []float64{0.5}})).NotTo(HaveOccurred())
+			for i := 1; i <= 4; i++ {
+				name, start, inc := stats.Trace("db.query")
+				clock.Advance(10 * time.Millisecond)
+				stats.End(name, start, inc)
+				if i == 2 {
+					stats.Flush()
+				}
+			}
+			snapshots := stats.Snapshots()
+			Expect(snapshots).To(HaveKey("db.query"))
+			Expect(snapshots["db.query"].Count()).To(Equal(uint64(4)))
+
+			recorder := httptest.NewRecorder()
+			stats.SketchHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/debug/gstats/sketches", nil))
+			summaries := map[string]sketchSummary{}
+			Expect(json.Unmarshal(recorder.Body.Bytes(), &summaries)).NotTo(HaveOccurred())
+			Expect(summaries["db.query"].Count).To(Equal(uint64(4)))
+			Expect(summaries["db.query"].Quantiles["p50"]).To(BeNumerically("~", 10, 0.1))
+		})
+	})
+}
@@ -1,15 +1,15 @@
 package gstats
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"net"
 	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
-	"unicode"
-	"unicode/utf8"
-
-	"github.com/cactus/go-statsd-client/statsd"
-	"github.com/etgryphon/stringUp"
 )
 
 type incrementer func(stat string, incrementBy int64) error
@@ -24,81 +24,338 @@ type Statser interface {
 	Gauge(string, int64) error
 }
 
-// wrapper/adapter around the cactus statsd client
+// Statsers that count outcomes themselves implement ResultStatser as well. It
+// is kept out of Statser so Statsers written before IncResult existed still
+// satisfy it, see the package-level IncResult.
+type ResultStatser interface {
+	IncResult(string, error) error
+}
+
+// Statsers that keep rate meters implement MeterStatser as well. It is kept
+// out of Statser so Statsers written before meters existed still satisfy it,
+// the package-level Mark and MultiStatser count marks with IncrementBy on
+// Statsers without meters.
+type MeterStatser interface {
+	Mark(string, int64)
+}
+
+// Statsers that send distributions implement HistogramStatser as well, it is
+// kept out of Statser for the same reason. Samples for Statsers without it go
+// through End as a timer of that many milliseconds, which is what Statistics
+// sends them as anyway.
+type HistogramStatser interface {
+	Histogram(string, int64) error
+}
+
+// buffers and sends stats to a statsd server
 type Statistics struct {
-	client            statsd.Statter
+	client            sender
+	filter            *ruleSender
+	prefix            string
 	IncrementBuffers  map[string]int64
 	BufferFlushPeriod time.Duration
+	// turns error text into stat names for IncErr and IncResult
+	Normalizer Normalizer
+	// buffered stats that stay at zero for this long are dropped from
+	// IncrementBuffers, zero keeps them forever
+	BufferIdleTimeout time.Duration
 	mu                chan bool
+	clock             Clock
+	flushRules        []flushRule
+	bufferAges        map[string]bufferAge
+	sketchMu          sync.Mutex  // guards sketchRules and sketches instead of mu
+	sketching         atomic.Bool // set once there are sketch rules
+	sketchRules       []sketchRule
+	sketches          map[string]*timerSketch
+	meters            sync.Map // of *Meter
+	collectors        map[string]*registeredCollector
+	heartbeat         bool
+	started           time.Time
+	profileLabels     bool
+	dogStatsD         bool
+	traceID           func(context.Context) string
+	exemplarMu        sync.Mutex // guards slowest and traced instead of mu
+	slowest           map[string][]Exemplar
+	traced            map[string]*tracedHistogram
+	// closed by Close to stop the flush loop
+	done      chan bool
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// Options configures CreateStatsdClientWithOptions. Zero values fall back to
+// the environment and then to the package defaults.
+type Options struct {
+	// statsd server address, defaults to $STATSD_ADDRESS. Several comma
+	// separated addresses are combined according to Routing.
+	Address string
+	// first element of every stat path, defaults to $STATSD_PREFIX
+	Prefix string
+	// how often buffered stats are sent, defaults to one second
+	BufferFlushPeriod time.Duration
+	// how often the statsd hostname is looked up again, defaults to
+	// $STATSD_RESOLVE_INTERVAL (e.g. "30s"). Zero resolves it only once.
+	ResolveInterval time.Duration
+	// used for those lookups, defaults to net.DefaultResolver
+	Resolver Resolver
+	// how stats are spread over several addresses, defaults to
+	// $STATSD_ROUTING and then to RouteFailover
+	Routing RoutingPolicy
+	// file to load stat name Rules from, defaults to $STATSD_RULES_FILE
+	RulesFile string
+	// where timers and the flush loop get the time from, defaults to the
+	// system clock
+	Clock Clock
+	// send build_info on startup, and build_info, uptime_seconds and
+	// heartbeat on every flush, defaults to $STATSD_HEARTBEAT (e.g. "true")
+	Heartbeat bool
+	// have NewStatser return a NoopStatser instead of an error when no
+	// address is configured
+	FailSoft bool
+	// have TraceContext set pprof labels and open runtime/trace regions,
+	// defaults to $STATSD_PROFILE_LABELS (e.g. "true")
+	ProfileLabels bool
+	// the statsd server understands DogStatsD tags, defaults to
+	// $STATSD_DOGSTATSD (e.g. "true")
+	DogStatsD bool
+	// finds the trace a context belongs to for EndContext, e.g. the
+	// OpenTelemetry span's trace ID. Defaults to TraceParentID.
+	TraceID func(context.Context) string
 }
 
 func CreateStatsdClient() (*Statistics, error) {
-	return _CreateStatsdClient(time.Second)
+	return CreateStatsdClientWithOptions(Options{})
 }
 
 func _CreateStatsdClient(bufferFlushPeriod time.Duration) (*Statistics, error) {
-	address := os.Getenv("STATSD_ADDRESS")
-	if address == "" {
+	return CreateStatsdClientWithOptions(Options{BufferFlushPeriod: bufferFlushPeriod})
+}
+
+func CreateStatsdClientWithOptions(opts Options) (*Statistics, error) {
+	if opts.Address == "" {
+		opts.Address = os.Getenv("STATSD_ADDRESS")
+	}
+	if opts.Address == "" {
 		return nil, errors.New("environment variable STATSD_ADDRESS not defined, cannot continue")
 	}
-	prefix := os.Getenv("STATSD_PREFIX")
-	if prefix == "" {
+	if opts.Prefix == "" {
+		opts.Prefix = os.Getenv("STATSD_PREFIX")
+	}
+	if opts.Prefix == "" {
 		return nil, errors.New("environment variable STATSD_PREFIX not defined, cannot continue")
 	}
-	client, err := statsd.New(address, prefix)
+	if opts.BufferFlushPeriod == 0 {
+		opts.BufferFlushPeriod = time.Second
+	}
+	if interval := os.Getenv("STATSD_RESOLVE_INTERVAL"); opts.ResolveInterval == 0 && interval != "" {
+		parsed, err := time.ParseDuration(interval)
+		if err != nil {
+			return nil, errors.New("environment variable STATSD_RESOLVE_INTERVAL is not a duration, cannot continue")
+		}
+		opts.ResolveInterval = parsed
+	}
+	if opts.Resolver == nil {
+		opts.Resolver = net.DefaultResolver
+	}
+	if opts.Clock == nil {
+		opts.Clock = realClock{}
+	}
+	if opts.Routing == "" {
+		opts.Routing = RoutingPolicy(os.Getenv("STATSD_ROUTING"))
+	}
+	if opts.Routing == "" {
+		opts.Routing = RouteFailover
+	}
+	if opts.RulesFile == "" {
+		opts.RulesFile = os.Getenv("STATSD_RULES_FILE")
+	}
+	if heartbeat := os.Getenv("STATSD_HEARTBEAT"); !opts.Heartbeat && heartbeat != "" {
+		parsed, err := strconv.ParseBool(heartbeat)
+		if err != nil {
+			return nil, errors.New("environment variable STATSD_HEARTBEAT is not true or false, cannot continue")
+		}
+		opts.Heartbeat = parsed
+	}
+	if labels := os.Getenv("STATSD_PROFILE_LABELS"); !opts.ProfileLabels && labels != "" {
+		parsed, err := strconv.ParseBool(labels)
+		if err != nil {
+			return nil, errors.New("environment variable STATSD_PROFILE_LABELS is not true or false, cannot continue")
+		}
+		opts.ProfileLabels = parsed
+	}
+	if dogStatsD := os.Getenv("STATSD_DOGSTATSD"); !opts.DogStatsD && dogStatsD != "" {
+		parsed, err := strconv.ParseBool(dogStatsD)
+		if err != nil {
+			return nil, errors.New("environment variable STATSD_DOGSTATSD is not true or false, cannot continue")
+		}
+		opts.DogStatsD = parsed
+	}
+	if opts.TraceID == nil {
+		opts.TraceID = TraceParentID
+	}
+	var rules *Rules
+	if opts.RulesFile != "" {
+		loaded, err := LoadRules(opts.RulesFile)
+		if err != nil {
+			return nil, errors.New("Couldn't load statsd rules.  StatsdRulesError=\"" + err.Error() + "\"")
+		}
+		rules = loaded
+	}
+	client, err := newSender(opts)
 	if err != nil {
 		return nil, errors.New("Couldn't initialize statsd.  StatsdInitError=\"" + err.Error() + "\"")
 	}
-	wrapper := Statistics{client, make(map[string]int64), bufferFlushPeriod, make(chan bool, 1)}
+	filter := &ruleSender{next: client, rules: rules}
+	wrapper := Statistics{
+		client:            filter,
+		filter:            filter,
+		prefix:            opts.Prefix,
+		Normalizer:        DefaultNormalizer,
+		IncrementBuffers:  make(map[string]int64),
+		BufferFlushPeriod: opts.BufferFlushPeriod,
+		BufferIdleTimeout: defaultBufferIdleTimeout,
+		mu:                make(chan bool, 1),
+		clock:             opts.Clock,
+		bufferAges:        make(map[string]bufferAge),
+		sketches:          make(map[string]*timerSketch),
+		collectors:        make(map[string]*registeredCollector),
+		heartbeat:         opts.Heartbeat,
+		started:           opts.Clock.Now(),
+		profileLabels:     opts.ProfileLabels,
+		dogStatsD:         opts.DogStatsD,
+		traceID:           opts.TraceID,
+		slowest:           make(map[string][]Exemplar),
+		traced:            make(map[string]*tracedHistogram),
+		done:              make(chan bool),
+	}
+	if wrapper.heartbeat {
+		wrapper.sendBuildInfo()
+	}
 	go wrapper.autoFlushBufferedStats()
 	return &wrapper, err
 }
 
 // defer stats.End(Trace("foobar"))
+// the start is read from time.Now, not from an injected Clock: End on a client
+// with a FakeClock subtracts it from the fake time, so use stats.Trace there
 func Trace(traceIdentifier string) (string, time.Time, int64) {
 	timestamp := time.Now()
 	return traceIdentifier, timestamp, 0
 }
 
 // defer stats.End(TraceAndIncrement("foobar"))
+// reads time.Now like Trace, use stats.TraceAndIncrement with an injected Clock
 func TraceAndIncrement(traceIdentifier string) (string, time.Time, int64) {
 	timestamp := time.Now()
 	return traceIdentifier, timestamp, 1
 }
 
+// defer stats.End(stats.Trace("foobar"))
+// like Trace, but reads the time from the client's Clock
+func (s *Statistics) Trace(traceIdentifier string) (string, time.Time, int64) {
+	return traceIdentifier, s.clock.Now(), 0
+}
+
+// defer stats.End(stats.TraceAndIncrement("foobar"))
+// like TraceAndIncrement, but reads the time from the client's Clock
+func (s *Statistics) TraceAndIncrement(traceIdentifier string) (string, time.Time, int64) {
+	return traceIdentifier, s.clock.Now(), 1
+}
+
 func (s *Statistics) autoFlushBufferedStats() {
 	for {
-		<-time.After(s.BufferFlushPeriod)
+		select {
+		case <-s.done:
+			return
+		case <-s.clock.After(s.BufferFlushPeriod):
+		}
 		s.flushBufferedStats()
+		if s.heartbeat {
+			s.sendHeartbeat()
+		}
 	}
 }
 
+// Flush does what a tick of the flush loop does right away: buffered stats
+// are sent unless their FlushPolicy holds them back for longer
+func (s *Statistics) Flush() {
+	s.flushBufferedStats()
+}
+
+// Close sends what is buffered, stops the flush loop and every registered
+// collector and closes the connection to statsd, including the goroutine that
+// re-resolves its hostname. Stats sent after Close are lost, closing again
+// is a no-op.
+func (s *Statistics) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.done)
+		s.flushBufferedStats()
+		s.mu <- true
+		for name, r := range s.collectors {
+			close(r.stop)
+			delete(s.collectors, name)
+		}
+		<-s.mu
+		s.closeErr = s.client.Close()
+	})
+	return s.closeErr
+}
+
 func (s *Statistics) flushBufferedStats() {
+	now := s.clock.Now()
 	s.mu <- true
-	defer func() { <-s.mu }()
-	for stat, incValue := range s.IncrementBuffers {
-		if incValue > 0 {
-			s.IncrementBuffers[stat] = 0
-			s.client.Inc(stat, incValue, 1.0)
+	for stat := range s.IncrementBuffers {
+		if s.dueForFlush(stat, now, true) {
+			s.flushStat(stat)
 		}
 	}
+	s.evictIdleBuffers(now)
+	<-s.mu
+	// sketches and meters have locks of their own
+	s.flushSketches()
+	s.flushMeters(now)
 }
 
-func (s *Statistics) _End(traceIdentifier string, timestamp time.Time, incrementBy int64, incFunc incrementer) {
-	endingTimestamp := time.Now()
-	duration := int64(endingTimestamp.Sub(timestamp) / time.Millisecond)
+// tags are DogStatsD tags for the timer, empty for none. Returns when the
+// call ended and how long it took.
+func (s *Statistics) _End(traceIdentifier string, timestamp time.Time, incrementBy int64, incFunc incrementer, tags string) (time.Time, time.Duration) {
+	endingTimestamp := s.clock.Now()
+	elapsed := endingTimestamp.Sub(timestamp)
+	duration := int64(elapsed / time.Millisecond)
 	if incrementBy > 0 {
 		incFunc(traceIdentifier+".count", incrementBy)
 	}
-	s.client.Timing(traceIdentifier, duration, 1)
+	if !s.sketchSample(traceIdentifier, float64(elapsed)/float64(time.Millisecond)) {
+		return endingTimestamp, elapsed
+	}
+	if tags == "" {
+		s.client.Timing(traceIdentifier, duration, 1)
+	} else {
+		s.client.preciseTiming(traceIdentifier, float64(duration), tags)
+	}
+	return endingTimestamp, elapsed
+}
+
+// sends d as a timer to the microsecond, for things that usually take less
+// than a millisecond. Statsers other than Statistics get it through End.
+func timeOn(s Statser, stat string, d time.Duration) {
+	stats, ok := s.(*Statistics)
+	if !ok {
+		s.End(stat, time.Now().Add(-d), 0)
+		return
+	}
+	milliseconds := float64(d/time.Microsecond) / 1000
+	if stats.sketchSample(stat, milliseconds) {
+		stats.client.preciseTiming(stat, milliseconds, "")
+	}
 }
 
 func (s *Statistics) End(traceIdentifier string, timestamp time.Time, incrementBy int64) {
-	s._End(traceIdentifier, timestamp, incrementBy, s.IncrementBy)
+	s._End(traceIdentifier, timestamp, incrementBy, s.IncrementBy, "")
 }
 
 func (s *Statistics) BufferedEnd(traceIdentifier string, timestamp time.Time, incrementBy int64) {
-	s._End(traceIdentifier, timestamp, incrementBy, s.BufferedIncrementBy)
+	s._End(traceIdentifier, timestamp, incrementBy, s.BufferedIncrementBy, "")
 }
 
 // stats.Inc("AnEvent")
@@ -107,28 +364,75 @@ func (s *Statistics) Inc(stat string) error {
 }
 
 // stats.IncErr("This.Event.Records", "my error message") => "This.Event.Records.MyErrorMessage.count"
-// expected behavior to strip non-western characters
+// expected behavior to strip non-western characters, a nil error counts nothing
 func (s *Statistics) IncErr(stat string, err error) error {
-	stat = fmt.Sprintf(stat+".%s.count", normalize(err))
+	if err == nil {
+		return nil
+	}
+	stat = fmt.Sprintf(stat+".%s.count", s.Normalizer.Normalize(err.Error()))
 	return s.IncrementBy(stat, 1)
 }
 
+// stats.IncResult("db.query", err) => "db.query.success.count" when err is nil,
+// "db.query.ConnectionRefused.count" otherwise. Errors joined with errors.Join
+// count once for every distinct error they hold.
+func (s *Statistics) IncResult(stat string, err error) error {
+	var first error
+	for _, outcome := range outcomes(err, s.Normalizer) {
+		if incErr := s.IncrementBy(stat+"."+outcome+".count", 1); incErr != nil && first == nil {
+			first = incErr
+		}
+	}
+	return first
+}
+
+// gstats.IncResult(s, "db.query", err) is s.IncResult for any Statser, a nil
+// Statser means Default(). Statsers without IncResult get Inc("db.query.success")
+// for a nil error and IncErr once for every distinct joined error otherwise.
+func IncResult(s Statser, stat string, err error) error {
+	if s == nil {
+		s = Default()
+	}
+	if r, ok := s.(ResultStatser); ok {
+		return r.IncResult(stat, err)
+	}
+	if err == nil {
+		return s.Inc(stat + ".success")
+	}
+	var first error
+	for _, leaf := range leafErrors(err) {
+		if incErr := s.IncErr(stat, leaf); incErr != nil && first == nil {
+			first = incErr
+		}
+	}
+	return first
+}
+
 // stats.IncrementBy("Requests", 5) // I got 5 requests!
 func (s *Statistics) IncrementBy(stat string, incrementBy int64) error {
 	return s.client.Inc(stat, incrementBy, 1.0)
 }
 
 // stats.BufferedIncrementBy("Requests", 5) // I got 5 requests!
+// the stat is sent when its FlushPolicy says so, see SetFlushPolicy
 func (s *Statistics) BufferedIncrementBy(stat string, incrementBy int64) error {
 	s.mu <- true
 	defer func() { <-s.mu }()
+	now := s.clock.Now()
 	// if we have never seen this stat before, we simply return 0 for val
 	val, _ := s.IncrementBuffers[stat]
 	s.IncrementBuffers[stat] = val + incrementBy
-	incValue, _ := s.IncrementBuffers[stat]
-	if s.IncrementBuffers[stat] >= 100 {
-		s.IncrementBuffers[stat] = 0
-		return s.client.Inc(stat, incValue, 1.0)
+	age := s.bufferAges[stat]
+	if s.IncrementBuffers[stat] == 0 {
+		// the increments cancelled each other out, there is nothing to send
+		age.first = time.Time{}
+	} else if age.first.IsZero() {
+		age.first = now
+	}
+	age.last = now
+	s.bufferAges[stat] = age
+	if s.dueForFlush(stat, now, false) {
+		return s.flushStat(stat)
 	}
 	return nil
 }
@@ -137,13 +441,57 @@ func (s *Statistics) Gauge(stat string, value int64) error {
 	return s.client.Gauge(stat, value, 1.0)
 }
 
-// expected behavior to strip non-western characters
-func normalize(toRecord error) string {
-	// the stringUp takes out the non-western chars
-	// "camelCase"
-	cameled := stringUp.CamelCase(toRecord.Error())
+// stats.Histogram("request.db_calls", 3) records one sample of a
+// distribution, sent as a statsd timer so it gets the same percentiles.
+// Sketch policies apply as they do to timers.
+func (s *Statistics) Histogram(stat string, value int64) error {
+	if s.sketchSample(stat, float64(value)) {
+		return s.client.Timing(stat, value, 1.0)
+	}
+	return nil
+}
+
+// records a histogram sample if s has them, times it with End otherwise
+func histogramOn(s Statser, stat string, value int64) error {
+	if h, ok := s.(HistogramStatser); ok {
+		return h.Histogram(stat, value)
+	}
+	s.End(stat, time.Now().Add(-time.Duration(value)*time.Millisecond), 0)
+	return nil
+}
+
+// outcomes names what happened for IncResult, "success" for a nil error and
+// the normalized text of every distinct underlying error otherwise
+func outcomes(err error, normalizer Normalizer) []string {
+	if err == nil {
+		return []string{"success"}
+	}
+	seen := map[string]bool{}
+	names := []string{}
+	for _, leaf := range leafErrors(err) {
+		name := normalizer.Normalize(leaf.Error())
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
 
-	// "CamelCase"
-	rune, size := utf8.DecodeRuneInString(cameled)
-	return string(unicode.ToUpper(rune)) + cameled[size:]
+// leafErrors flattens errors.Join style multi-errors, anything else is a leaf
+func leafErrors(err error) []error {
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		return []error{err}
+	}
+	leaves := []error{}
+	for _, e := range joined.Unwrap() {
+		if e != nil {
+			leaves = append(leaves, leafErrors(e)...)
+		}
+	}
+	if len(leaves) == 0 {
+		return []error{err}
+	}
+	return leaves
 }
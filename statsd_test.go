@@ -36,7 +36,7 @@ func TestStatsd(t *testing.T) {
 			Expect(1).To(Equal(1))
 		})
 	})
-	g.Describe("Normalization (vendored import)", func() {
+	g.Describe("Normalization", func() {
 		g.It("should correctly cammel-case a simple happy-path error text", func() {
 			err := errors.New("cammel case")
 			normalizedErrorString := normalize(err)
@@ -82,6 +82,7 @@ func TestStatsd(t *testing.T) {
 			sock = nil
 			addr, err = net.ResolveUDPAddr("udp", "127.0.0.1:31337")
 			sock, err = net.ListenUDP("udp", addr)
+			Expect(err).NotTo(HaveOccurred())
 			os.Setenv("STATSD_ADDRESS", "127.0.0.1:31337")
 			os.Setenv("STATSD_PREFIX", "test")
 		})
@@ -127,25 +128,17 @@ func TestStatsd(t *testing.T) {
 			Expect(driftNanoseconds).Should(BeNumerically("<", 10*time.Millisecond))
 		})
 		g.It("should send accurate timing even with BufferedEnd", func() {
-			stats, err := _CreateStatsdClient(100 * time.Millisecond)
+			clock := NewFakeClock(time.Now())
+			stats, err := CreateStatsdClientWithOptions(Options{BufferFlushPeriod: 100 * time.Millisecond, Clock: clock})
 			Expect(err).NotTo(HaveOccurred())
-			// Note: usually, we'd handle tracing in a call that looks like this:
-			// defer stats.End(Trace("testing trace"))
-			// but because we're trying to get results from the UDP listener
-			// we've stubbed in instead of a real statsd service, we need more
-			// method body after the "do some work for a while" part of our function.
-			// In order to accomodate this, we need to break things up in a way
-			// that won't be used in real code very often
-			traceIdentifier, timestamp, incrementBy := Trace("testing trace")
+			traceIdentifier, timestamp, incrementBy := stats.Trace("testing trace")
 			// do some work for a while
-			time.Sleep(1 * time.Millisecond)
+			clock.Advance(1 * time.Millisecond)
 			stats.BufferedEnd(traceIdentifier, timestamp, incrementBy)
-			time.Sleep(105 * time.Millisecond)
+			// timings are never buffered, only the count would wait for a flush
 			readLength, _, err := sock.ReadFromUDP(buf)
 			Expect(err).NotTo(HaveOccurred())
-			readStr := string(buf[:readLength])
-			driftNanoseconds := helper_GetDriftFromTrace(readStr, "test", "testing trace")
-			Expect(driftNanoseconds).Should(BeNumerically("<", 10*time.Millisecond))
+			Expect(string(buf[:readLength])).To(Equal("test.testing trace:1|ms"))
 		})
 		g.It("should trace and count", func() {
 			stats, err := CreateStatsdClient()
@@ -167,23 +160,22 @@ func TestStatsd(t *testing.T) {
 			Expect(driftNanoseconds).Should(BeNumerically("<", 10*time.Millisecond))
 		})
 		g.It("should trace and count even with BufferedEnd", func() {
-			stats, err := _CreateStatsdClient(100 * time.Millisecond)
+			clock := NewFakeClock(time.Now())
+			stats, err := CreateStatsdClientWithOptions(Options{BufferFlushPeriod: 100 * time.Millisecond, Clock: clock})
 			Expect(err).NotTo(HaveOccurred())
-			traceIdentifier, timestamp, incrementBy := TraceAndIncrement("testing trace")
+			traceIdentifier, timestamp, incrementBy := stats.TraceAndIncrement("testing trace")
 			// do some work for a while
-			time.Sleep(1 * time.Millisecond)
+			clock.Advance(1 * time.Millisecond)
 			stats.BufferedEnd(traceIdentifier, timestamp, incrementBy)
-			time.Sleep(105 * time.Millisecond)
 
 			readLength, _, err := sock.ReadFromUDP(buf)
 			Expect(err).NotTo(HaveOccurred())
-			readStr := string(buf[:readLength])
-			driftNanoseconds := helper_GetDriftFromTrace(readStr, "test", "testing trace")
-			Expect(driftNanoseconds).Should(BeNumerically("<", 10*time.Millisecond))
+			Expect(string(buf[:readLength])).To(Equal("test.testing trace:1|ms"))
 
+			clock.BlockUntil(1)
+			clock.Advance(100 * time.Millisecond)
 			readLength, _, err = sock.ReadFromUDP(buf)
 			Expect(err).NotTo(HaveOccurred())
-			readStr = string(buf[:readLength])
 			Expect(string(buf[:readLength])).To(Equal("test.testing trace.count:1|c"))
 		})
 		g.It("should stat normalized error text", func() {
@@ -197,6 +189,49 @@ func TestStatsd(t *testing.T) {
 			Expect(err).NotTo(HaveOccurred())
 			Expect(string(buf[:readLength])).To(Equal("test.myStat.CustomErrorIncludingPunctuationPerl.count:1|c"))
 		})
+		g.It("should not count or crash on a nil error", func() {
+			stats, err := CreateStatsdClient()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stats.IncErr("myStat", nil)).NotTo(HaveOccurred())
+			sock.SetReadDeadline(time.Now().Add(20 * time.Millisecond))
+			_, _, err = sock.ReadFromUDP(buf)
+			Expect(err).To(HaveOccurred())
+		})
+		g.It("should count a nil result as a success", func() {
+			stats, err := CreateStatsdClient()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stats.IncResult("myStat", nil)).NotTo(HaveOccurred())
+			readLength, _, err := sock.ReadFromUDP(buf)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(buf[:readLength])).To(Equal("test.myStat.success.count:1|c"))
+		})
+		g.It("should count a failed result by its normalized error", func() {
+			stats, err := CreateStatsdClient()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stats.IncResult("myStat", errors.New("connection refused"))).NotTo(HaveOccurred())
+			readLength, _, err := sock.ReadFromUDP(buf)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(buf[:readLength])).To(Equal("test.myStat.ConnectionRefused.count:1|c"))
+		})
+		g.It("should count every distinct joined error once", func() {
+			stats, err := CreateStatsdClient()
+			Expect(err).NotTo(HaveOccurred())
+			joined := errors.Join(
+				errors.New("timeout"),
+				errors.Join(errors.New("not found"), errors.New("timeout")),
+				nil,
+			)
+			Expect(stats.IncResult("myStat", joined)).NotTo(HaveOccurred())
+			readLength, _, err := sock.ReadFromUDP(buf)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(buf[:readLength])).To(Equal("test.myStat.Timeout.count:1|c"))
+			readLength, _, err = sock.ReadFromUDP(buf)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(buf[:readLength])).To(Equal("test.myStat.NotFound.count:1|c"))
+			sock.SetReadDeadline(time.Now().Add(20 * time.Millisecond))
+			_, _, err = sock.ReadFromUDP(buf)
+			Expect(err).To(HaveOccurred())
+		})
 		g.It("should increment by the requested amount", func() {
 			stats, err := CreateStatsdClient()
 			Expect(err).NotTo(HaveOccurred())
@@ -249,16 +284,128 @@ func TestStatsd(t *testing.T) {
 			Expect(string(buf[:readLength])).To(Equal("test.testing IncrementBy 2:100|c"))
 		})
 		g.It("should flush stats periodically", func() {
-			stats, err := _CreateStatsdClient(100 * time.Millisecond)
+			clock := NewFakeClock(time.Now())
+			stats, err := CreateStatsdClientWithOptions(Options{BufferFlushPeriod: 100 * time.Millisecond, Clock: clock})
 			Expect(err).NotTo(HaveOccurred())
 			for i := 0; i < 5; i++ {
 				err = stats.BufferedIncrementBy("testing IncrementBy", int64(19))
 				Expect(err).NotTo(HaveOccurred())
 			}
-			time.Sleep(105 * time.Millisecond)
+			clock.BlockUntil(1)
+			clock.Advance(100 * time.Millisecond)
 			readLength, _, err := sock.ReadFromUDP(buf)
 			Expect(readLength).To(BeNumerically(">", 0))
 			Expect(string(buf[:readLength])).To(Equal("test.testing IncrementBy:95|c"))
 		})
+		g.It("should send buffered stats when closed", func() {
+			stats, err := CreateStatsdClientWithOptions(Options{BufferFlushPeriod: time.Hour, Clock: NewFakeClock(time.Now())})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stats.BufferedIncrementBy("closing", 3)).NotTo(HaveOccurred())
+			Expect(stats.Close()).NotTo(HaveOccurred())
+			readLength, _, err := sock.ReadFromUDP(buf)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(buf[:readLength])).To(Equal("test.closing:3|c"))
+			Expect(stats.Close()).NotTo(HaveOccurred())
+		})
+		g.It("should flush negative buffered totals periodically", func() {
+			clock := NewFakeClock(time.Now())
+			stats, err := CreateStatsdClientWithOptions(Options{BufferFlushPeriod: 100 * time.Millisecond, Clock: clock})
+			Expect(err).NotTo(HaveOccurred())
+			for i := 0; i < 5; i++ {
+				err = stats.BufferedIncrementBy("testing DecrementBy", int64(-19))
+				Expect(err).NotTo(HaveOccurred())
+			}
+			clock.BlockUntil(1)
+			clock.Advance(100 * time.Millisecond)
+			readLength, _, err := sock.ReadFromUDP(buf)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(buf[:readLength])).To(Equal("test.testing DecrementBy:-95|c"))
+		})
+		g.It("should buffer decrements until they get to -100", func() {
+			stats, err := CreateStatsdClient()
+			Expect(err).NotTo(HaveOccurred())
+			for i := 0; i < 5; i++ {
+				err = stats.BufferedIncrementBy("testing DecrementBy", int64(-20))
+				Expect(err).NotTo(HaveOccurred())
+			}
+			readLength, _, err := sock.ReadFromUDP(buf)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(buf[:readLength])).To(Equal("test.testing DecrementBy:-100|c"))
+		})
+		g.It("should not send anything when buffered increments cancel out", func() {
+			stats, err := CreateStatsdClient()
+			Expect(err).NotTo(HaveOccurred())
+			err = stats.BufferedIncrementBy("testing zero crossing", int64(60))
+			Expect(err).NotTo(HaveOccurred())
+			err = stats.BufferedIncrementBy("testing zero crossing", int64(-60))
+			Expect(err).NotTo(HaveOccurred())
+			stats.Flush()
+			sock.SetReadDeadline(time.Now().Add(20 * time.Millisecond))
+			_, _, err = sock.ReadFromUDP(buf)
+			Expect(err).To(HaveOccurred())
+		})
+		g.It("should honour per-stat count thresholds", func() {
+			stats, err := CreateStatsdClient()
+			Expect(err).NotTo(HaveOccurred())
+			err = stats.SetFlushPolicy("small.*", FlushPolicy{Count: 3})
+			Expect(err).NotTo(HaveOccurred())
+			for i := 0; i < 3; i++ {
+				err = stats.BufferedIncrementBy("small.batch", int64(1))
+				Expect(err).NotTo(HaveOccurred())
+			}
+			readLength, _, err := sock.ReadFromUDP(buf)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(buf[:readLength])).To(Equal("test.small.batch:3|c"))
+		})
+		g.It("should send stats once they reach their max age", func() {
+			clock := NewFakeClock(time.Now())
+			stats, err := CreateStatsdClientWithOptions(Options{Clock: clock})
+			Expect(err).NotTo(HaveOccurred())
+			err = stats.SetFlushPolicy("aged", FlushPolicy{MaxAge: 10 * time.Millisecond})
+			Expect(err).NotTo(HaveOccurred())
+			err = stats.BufferedIncrementBy("aged", int64(1))
+			Expect(err).NotTo(HaveOccurred())
+			clock.Advance(10 * time.Millisecond)
+			err = stats.BufferedIncrementBy("aged", int64(1))
+			Expect(err).NotTo(HaveOccurred())
+			readLength, _, err := sock.ReadFromUDP(buf)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(buf[:readLength])).To(Equal("test.aged:2|c"))
+		})
+		g.It("should reject malformed flush policy patterns", func() {
+			stats, err := CreateStatsdClient()
+			Expect(err).NotTo(HaveOccurred())
+			err = stats.SetFlushPolicy("[", FlushPolicy{Count: 3})
+			Expect(err).To(HaveOccurred())
+		})
+		g.It("should hold stats back until their max age on flush", func() {
+			clock := NewFakeClock(time.Now())
+			stats, err := CreateStatsdClientWithOptions(Options{Clock: clock})
+			Expect(err).NotTo(HaveOccurred())
+			err = stats.SetFlushPolicy("aged", FlushPolicy{MaxAge: time.Minute})
+			Expect(err).NotTo(HaveOccurred())
+			err = stats.BufferedIncrementBy("aged", int64(1))
+			Expect(err).NotTo(HaveOccurred())
+			stats.Flush()
+			Expect(stats.IncrementBuffers["aged"]).To(Equal(int64(1)))
+			clock.Advance(time.Minute)
+			stats.Flush()
+			readLength, _, err := sock.ReadFromUDP(buf)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(buf[:readLength])).To(Equal("test.aged:1|c"))
+		})
+		g.It("should evict idle buffered stats", func() {
+			clock := NewFakeClock(time.Now())
+			stats, err := CreateStatsdClientWithOptions(Options{Clock: clock})
+			Expect(err).NotTo(HaveOccurred())
+			stats.BufferIdleTimeout = 20 * time.Millisecond
+			err = stats.BufferedIncrementBy("testing eviction", int64(1))
+			Expect(err).NotTo(HaveOccurred())
+			stats.Flush()
+			Expect(stats.IncrementBuffers).To(HaveKey("testing eviction"))
+			clock.Advance(20 * time.Millisecond)
+			stats.Flush()
+			Expect(stats.IncrementBuffers).NotTo(HaveKey("testing eviction"))
+		})
 	})
 }
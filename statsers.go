@@ -0,0 +1,177 @@
+package gstats
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// NoopStatser sends nothing. NewStatser returns one when FailSoft is set and
+// no statsd address is configured, e.g. in local development.
+type NoopStatser struct{}
+
+func (NoopStatser) End(string, time.Time, int64)            {}
+func (NoopStatser) BufferedEnd(string, time.Time, int64)    {}
+func (NoopStatser) Inc(string) error                        { return nil }
+func (NoopStatser) IncErr(string, error) error              { return nil }
+func (NoopStatser) IncResult(string, error) error           { return nil }
+func (NoopStatser) IncrementBy(string, int64) error         { return nil }
+func (NoopStatser) BufferedIncrementBy(string, int64) error { return nil }
+func (NoopStatser) Gauge(string, int64) error               { return nil }
+func (NoopStatser) Mark(string, int64)                      {}
+func (NoopStatser) Histogram(string, int64) error           { return nil }
+
+// NewStatser is CreateStatsdClientWithOptions for callers that only need a
+// Statser. With opts.FailSoft and no address in opts or $STATSD_ADDRESS it
+// returns a NoopStatser instead of an error.
+func NewStatser(opts Options) (Statser, error) {
+	if opts.FailSoft && opts.Address == "" && os.Getenv("STATSD_ADDRESS") == "" {
+		return NoopStatser{}, nil
+	}
+	stats, err := CreateStatsdClientWithOptions(opts)
+	if err != nil {
+		// a nil *Statistics in a Statser would not compare equal to nil
+		return nil, err
+	}
+	return stats, nil
+}
+
+// MultiStatser sends every call to each of its Statsers, e.g. statsd and a
+// LogStatser while debugging. Methods return the first error.
+// > stats := gstats.NewMultiStatser(statsdStats, gstats.NewLogStatser(nil))
+type MultiStatser struct {
+	statsers []Statser
+}
+
+func NewMultiStatser(statsers ...Statser) *MultiStatser {
+	return &MultiStatser{statsers}
+}
+
+func (m *MultiStatser) each(call func(Statser) error) error {
+	var first error
+	for _, s := range m.statsers {
+		if err := call(s); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+func (m *MultiStatser) End(stat string, timestamp time.Time, incrementBy int64) {
+	m.each(func(s Statser) error { s.End(stat, timestamp, incrementBy); return nil })
+}
+
+func (m *MultiStatser) BufferedEnd(stat string, timestamp time.Time, incrementBy int64) {
+	m.each(func(s Statser) error { s.BufferedEnd(stat, timestamp, incrementBy); return nil })
+}
+
+func (m *MultiStatser) Inc(stat string) error {
+	return m.each(func(s Statser) error { return s.Inc(stat) })
+}
+
+func (m *MultiStatser) IncErr(stat string, err error) error {
+	return m.each(func(s Statser) error { return s.IncErr(stat, err) })
+}
+
+func (m *MultiStatser) IncResult(stat string, err error) error {
+	return m.each(func(s Statser) error { return IncResult(s, stat, err) })
+}
+
+func (m *MultiStatser) IncrementBy(stat string, incrementBy int64) error {
+	return m.each(func(s Statser) error { return s.IncrementBy(stat, incrementBy) })
+}
+
+func (m *MultiStatser) BufferedIncrementBy(stat string, incrementBy int64) error {
+	return m.each(func(s Statser) error { return s.BufferedIncrementBy(stat, incrementBy) })
+}
+
+func (m *MultiStatser) Gauge(stat string, value int64) error {
+	return m.each(func(s Statser) error { return s.Gauge(stat, value) })
+}
+
+func (m *MultiStatser) Mark(stat string, n int64) {
+	m.each(func(s Statser) error { markOn(s, stat, n); return nil })
+}
+
+func (m *MultiStatser) Histogram(stat string, value int64) error {
+	return m.each(func(s Statser) error { return histogramOn(s, stat, value) })
+}
+
+// LogStatser logs every stat instead of sending it, under the name
+// Statistics would send it as:
+//
+//	level=INFO msg=stat type=counter stat=checkout.count value=1
+//	level=INFO msg=stat type=timer stat=checkout value=12ms
+type LogStatser struct {
+	logger *slog.Logger
+	// turns errors into stat names for IncErr and IncResult
+	Normalizer Normalizer
+	// the level stats are logged at, slog.LevelInfo by default
+	Level slog.Level
+}
+
+// nil logs to slog.Default()
+func NewLogStatser(logger *slog.Logger) *LogStatser {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &LogStatser{logger: logger, Normalizer: DefaultNormalizer}
+}
+
+func (l *LogStatser) log(kind, stat string, value interface{}) {
+	l.logger.Log(context.Background(), l.Level, "stat", "type", kind, "stat", stat, "value", value)
+}
+
+func (l *LogStatser) End(stat string, timestamp time.Time, incrementBy int64) {
+	if incrementBy > 0 {
+		l.log("counter", stat+".count", incrementBy)
+	}
+	l.log("timer", stat, time.Since(timestamp).Round(time.Millisecond))
+}
+
+func (l *LogStatser) BufferedEnd(stat string, timestamp time.Time, incrementBy int64) {
+	l.End(stat, timestamp, incrementBy)
+}
+
+func (l *LogStatser) Inc(stat string) error {
+	return l.IncrementBy(stat+".count", 1)
+}
+
+func (l *LogStatser) IncErr(stat string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return l.IncrementBy(stat+"."+l.Normalizer.Normalize(err.Error())+".count", 1)
+}
+
+func (l *LogStatser) IncResult(stat string, err error) error {
+	for _, outcome := range outcomes(err, l.Normalizer) {
+		l.IncrementBy(stat+"."+outcome+".count", 1)
+	}
+	return nil
+}
+
+func (l *LogStatser) IncrementBy(stat string, incrementBy int64) error {
+	l.log("counter", stat, incrementBy)
+	return nil
+}
+
+// logged right away, there is nothing to buffer for
+func (l *LogStatser) BufferedIncrementBy(stat string, incrementBy int64) error {
+	return l.IncrementBy(stat, incrementBy)
+}
+
+func (l *LogStatser) Gauge(stat string, value int64) error {
+	l.log("gauge", stat, value)
+	return nil
+}
+
+func (l *LogStatser) Mark(stat string, n int64) {
+	l.log("meter", stat, n)
+}
+
+func (l *LogStatser) Histogram(stat string, value int64) error {
+	l.log("histogram", stat, value)
+	return nil
+}
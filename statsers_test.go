@@ -0,0 +1,158 @@
+package gstats
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/franela/goblin"
+	. "github.com/onsi/gomega"
+)
+
+type helper_FailingStatser struct {
+	NoopStatser
+}
+
+func (helper_FailingStatser) Inc(string) error {
+	return errors.New("backend down")
+}
+
+// only has the methods every Statser has
+type helper_CoreStatser struct {
+	Statser
+}
+
+func TestStatsers(t *testing.T) {
+	g := Goblin(t)
+	RegisterFailHandler(func(m string, _ ...int) { g.Fail(m) })
+	g.Describe("NewStatser", func() {
+		var address string
+		g.BeforeEach(func() {
+			address = os.Getenv("STATSD_ADDRESS")
+			os.Unsetenv("STATSD_ADDRESS")
+		})
+		g.AfterEach(func() {
+			os.Setenv("STATSD_ADDRESS", address)
+		})
+		g.It("should fail without an address", func() {
+			stats, err := NewStatser(Options{Prefix: "test"})
+			Expect(err).To(HaveOccurred())
+			Expect(stats == nil).To(BeTrue())
+		})
+		g.It("should send nothing without an address when failing soft", func() {
+			stats, err := NewStatser(Options{FailSoft: true})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stats).To(Equal(NoopStatser{}))
+		})
+		g.It("should still use statsd when an address is given", func() {
+			stats, err := NewStatser(Options{Address: "127.0.0.1:8125", Prefix: "test", FailSoft: true})
+			Expect(err).NotTo(HaveOccurred())
+			_, ok := stats.(*Statistics)
+			Expect(ok).To(BeTrue())
+		})
+	})
+	g.Describe("MultiStatser", func() {
+		g.It("should send every call to every Statser", func() {
+			first, second := NewMock(), NewMock()
+			stats := NewMultiStatser(&first, &second)
+			now := time.Now()
+			stats.Inc("inc")
+			stats.IncErr("incerr", errors.New("boom"))
+			stats.IncResult("result", nil)
+			stats.IncrementBy("by", 2)
+			stats.BufferedIncrementBy("buffered", 3)
+			stats.Gauge("gauge", 4)
+			stats.End("end", now, 1)
+			stats.BufferedEnd("bufferedend", now, 1)
+			stats.Mark("mark", 5)
+			stats.Histogram("histogram", 6)
+			for _, mock := range []MockStatser{first, second} {
+				Expect(mock.CallsToInc).To(Equal([]IncSignature{{"inc"}}))
+				Expect(len(mock.CallsToIncErr)).To(Equal(1))
+				Expect(len(mock.CallsToIncResult)).To(Equal(1))
+				Expect(mock.CallsToIncrementBy).To(Equal([]IncrementBySignature{{"by", 2}}))
+				Expect(mock.CallsToBufferedIncrementBy).To(Equal([]IncrementBySignature{{"buffered", 3}}))
+				Expect(mock.CallsToGauge).To(Equal([]GaugeSignature{{"gauge", 4}}))
+				Expect(mock.CallsToEnd).To(Equal([]EndSignature{{"end", now, 1}}))
+				Expect(mock.CallsToBufferedEnd).To(Equal([]EndSignature{{"bufferedend", now, 1}}))
+				Expect(mock.Marked("mark")).To(Equal(int64(5)))
+				Expect(mock.CallsToHistogram).To(Equal([]HistogramSignature{{"histogram", 6}}))
+			}
+		})
+		g.It("should count results on Statsers without IncResult", func() {
+			mock := NewMock()
+			core := helper_CoreStatser{&mock}
+			Expect(IncResult(core, "op", nil)).NotTo(HaveOccurred())
+			Expect(IncResult(core, "op", errors.Join(errors.New("timeout"), errors.New("not found")))).NotTo(HaveOccurred())
+			Expect(mock.CallsToIncResult).To(BeEmpty())
+			Expect(mock.CallsToInc).To(Equal([]IncSignature{{"op.success"}}))
+			Expect(len(mock.CallsToIncErr)).To(Equal(2))
+			Expect(mock.CallsToIncErr[0].Err).To(MatchError("timeout"))
+			Expect(mock.CallsToIncErr[1].Err).To(MatchError("not found"))
+		})
+		g.It("should count marks on Statsers without meters", func() {
+			mock := NewMock()
+			NewMultiStatser(helper_CoreStatser{&mock}).Mark("mark", 5)
+			Expect(mock.CallsToMark).To(BeEmpty())
+			Expect(mock.CallsToIncrementBy).To(Equal([]IncrementBySignature{{"mark", 5}}))
+		})
+		g.It("should time histogram samples on Statsers without histograms", func() {
+			mock := NewMock()
+			NewMultiStatser(helper_CoreStatser{&mock}).Histogram("histogram", 6)
+			Expect(mock.CallsToHistogram).To(BeEmpty())
+			Expect(len(mock.CallsToEnd)).To(Equal(1))
+			Expect(mock.CallsToEnd[0].Str).To(Equal("histogram"))
+			Expect(time.Since(mock.CallsToEnd[0].Tim)).To(BeNumerically(">=", 6*time.Millisecond))
+		})
+		g.It("should keep going past a failing Statser and return its error", func() {
+			mock := NewMock()
+			stats := NewMultiStatser(helper_FailingStatser{}, &mock)
+			err := stats.Inc("inc")
+			Expect(err).To(MatchError("backend down"))
+			Expect(len(mock.CallsToInc)).To(Equal(1))
+		})
+	})
+	g.Describe("LogStatser", func() {
+		g.It("should log stats under the names statsd would get", func() {
+			out := bytes.Buffer{}
+			logger := slog.New(slog.NewTextHandler(&out, &slog.HandlerOptions{
+				ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+					if a.Key == slog.TimeKey {
+						return slog.Attr{}
+					}
+					return a
+				},
+			}))
+			stats := NewLogStatser(logger)
+			stats.Inc("checkout")
+			stats.IncErr("checkout", errors.New("connection refused"))
+			stats.IncResult("checkout", nil)
+			stats.Gauge("queue.length", 7)
+			stats.Histogram("checkout.db.calls", 3)
+			Expect(strings.Split(strings.TrimSpace(out.String()), "\n")).To(Equal([]string{
+				"level=INFO msg=stat type=counter stat=checkout.count value=1",
+				"level=INFO msg=stat type=counter stat=checkout.ConnectionRefused.count value=1",
+				"level=INFO msg=stat type=counter stat=checkout.success.count value=1",
+				"level=INFO msg=stat type=gauge stat=queue.length value=7",
+				"level=INFO msg=stat type=histogram stat=checkout.db.calls value=3",
+			}))
+
+			out.Reset()
+			stats.End("checkout", time.Now(), 0)
+			Expect(out.String()).To(MatchRegexp(`type=timer stat=checkout value=[0-9.]+[mµn]?s\n`))
+		})
+		g.It("should respect the logger's level", func() {
+			out := bytes.Buffer{}
+			stats := NewLogStatser(slog.New(slog.NewTextHandler(&out, &slog.HandlerOptions{Level: slog.LevelWarn})))
+			stats.Inc("quiet")
+			Expect(out.String()).To(BeEmpty())
+			stats.Level = slog.LevelWarn
+			stats.Inc("loud")
+			Expect(out.String()).To(ContainSubstring("stat=loud.count"))
+		})
+	})
+}
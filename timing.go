@@ -0,0 +1,59 @@
+package gstats
+
+import "time"
+
+// Time calls f, timing it with End, which also counts the call, and counting
+// a returned error with IncErr. A panic is counted like RecoverAndCount, as
+// "stat.panic.<what panicked>.count", and carries on up the stack. A nil
+// Statser means Default().
+// > err := gstats.Time(stats, "db.migrate", migrate)
+func Time(s Statser, stat string, f func() error) error {
+	_, err := TimeValue(s, stat, func() (struct{}, error) {
+		return struct{}{}, f()
+	})
+	return err
+}
+
+// TimeValue is Time for functions that return a value as well
+// > user, err := gstats.TimeValue(stats, "db.user", func() (*User, error) {
+// > 	return db.LoadUser(id)
+// > })
+func TimeValue[T any](s Statser, stat string, f func() (T, error)) (T, error) {
+	if s == nil {
+		s = Default()
+	}
+	start := startTime(s)
+	returned := false
+	defer func() {
+		if returned {
+			return
+		}
+		// nil when f called runtime.Goexit rather than panicking
+		r := recover()
+		if r != nil {
+			countPanic(s, stat, r)
+		}
+		s.End(stat, start, 1)
+		if r != nil {
+			// the crash trace still starts where f panicked
+			panic(r)
+		}
+	}()
+	value, err := f()
+	returned = true
+	s.End(stat, start, 1)
+	s.IncErr(stat, err)
+	return value, err
+}
+
+// Statistics times with its own Clock, see Statistics.Trace
+func startTime(s Statser) time.Time {
+	return clockOf(s).Now()
+}
+
+func clockOf(s Statser) Clock {
+	if stats, ok := s.(*Statistics); ok {
+		return stats.clock
+	}
+	return realClock{}
+}
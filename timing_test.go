@@ -0,0 +1,74 @@
+package gstats
+
+import (
+	"errors"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	. "github.com/franela/goblin"
+	. "github.com/onsi/gomega"
+)
+
+func TestTiming(t *testing.T) {
+	g := Goblin(t)
+	RegisterFailHandler(func(m string, _ ...int) { g.Fail(m) })
+	g.Describe("Time", func() {
+		var mock MockStatser
+		g.BeforeEach(func() {
+			mock = NewMock()
+		})
+		g.It("should time and count a call that succeeds", func() {
+			Expect(Time(&mock, "db.migrate", func() error { return nil })).NotTo(HaveOccurred())
+			Expect(len(mock.CallsToEnd)).To(Equal(1))
+			Expect(mock.CallsToEnd[0].Str).To(Equal("db.migrate"))
+			Expect(mock.CallsToEnd[0].Num).To(Equal(int64(1)))
+			Expect(mock.CallsToIncErr).To(Equal([]IncErrSignature{{"db.migrate", nil}}))
+		})
+		g.It("should count the error a call returns", func() {
+			failure := errors.New("connection refused")
+			Expect(Time(&mock, "db.migrate", func() error { return failure })).To(Equal(failure))
+			Expect(len(mock.CallsToEnd)).To(Equal(1))
+			Expect(mock.CallsToIncErr).To(Equal([]IncErrSignature{{"db.migrate", failure}}))
+		})
+		g.It("should hand back the value", func() {
+			value, err := TimeValue(&mock, "db.user", func() (string, error) { return "ada", nil })
+			Expect(err).NotTo(HaveOccurred())
+			Expect(value).To(Equal("ada"))
+			Expect(mock.CallsToEnd[0].Str).To(Equal("db.user"))
+		})
+		g.It("should count a panic and let it carry on", func() {
+			Expect(func() {
+				TimeValue(&mock, "db.user", func() (int, error) { panic("bug") })
+			}).To(Panic())
+			Expect(mock.CallsToInc).To(Equal([]IncSignature{{"db.user.panic.String"}}))
+			Expect(len(mock.CallsToEnd)).To(Equal(1))
+			Expect(mock.CallsToIncErr).To(BeEmpty())
+		})
+		g.It("should use the default Statser when given nil", func() {
+			helper_ResetDefault()
+			defer helper_ResetDefault()
+			SetDefault(&mock)
+			Time(nil, "defaulted", func() error { return nil })
+			Expect(mock.CallsToEnd[0].Str).To(Equal("defaulted"))
+		})
+		g.It("should time on the client's clock", func() {
+			sock, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+			Expect(err).NotTo(HaveOccurred())
+			defer sock.Close()
+			os.Setenv("STATSD_ADDRESS", sock.LocalAddr().String())
+			os.Setenv("STATSD_PREFIX", "test")
+			clock := NewFakeClock(time.Now())
+			stats, err := CreateStatsdClientWithOptions(Options{Clock: clock, BufferFlushPeriod: time.Hour})
+			Expect(err).NotTo(HaveOccurred())
+			Time(stats, "slow", func() error {
+				clock.Advance(40 * time.Millisecond)
+				return errors.New("timeout")
+			})
+			Expect(helper_ReadUDP(sock)).To(Equal("test.slow.count:1|c"))
+			Expect(helper_ReadUDP(sock)).To(Equal("test.slow:40|ms"))
+			Expect(helper_ReadUDP(sock)).To(Equal("test.slow.Timeout.count:1|c"))
+		})
+	})
+}
@@ -0,0 +1,174 @@
+package gstats
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	dialTimeout  = time.Second
+	writeTimeout = time.Second
+	// transports wait this long before the first reconnect attempt
+	// and double the wait after every failure, up to maxReconnectDelay
+	minReconnectDelay = 50 * time.Millisecond
+	maxReconnectDelay = 10 * time.Second
+
+	errReconnectPending = errors.New("statsd connection is down, waiting to reconnect")
+)
+
+// a transport delivers one statsd line per call to Write
+type transport interface {
+	Write(line []byte) error
+	Close() error
+}
+
+// parseAddress splits STATSD_ADDRESS into a network and an address that can
+// be handed to net.Dial. A bare host:port is treated as udp.
+//
+//	"127.0.0.1:8125"                  -> udp 127.0.0.1:8125
+//	"tcp://relay.example.com:8125"    -> tcp relay.example.com:8125
+//	"unixgram:///var/run/statsd.sock" -> unixgram /var/run/statsd.sock
+func parseAddress(address string) (string, string, error) {
+	if !strings.Contains(address, "://") {
+		return "udp", address, nil
+	}
+	u, err := url.Parse(address)
+	if err != nil {
+		return "", "", err
+	}
+	switch u.Scheme {
+	case "udp", "tcp":
+		if u.Host == "" {
+			return "", "", errors.New("no host:port in statsd address \"" + address + "\"")
+		}
+		return u.Scheme, u.Host, nil
+	case "unix", "unixgram":
+		if u.Host+u.Path == "" {
+			return "", "", errors.New("no socket path in statsd address \"" + address + "\"")
+		}
+		return u.Scheme, u.Host + u.Path, nil
+	}
+	return "", "", errors.New("unsupported statsd transport \"" + u.Scheme + "\"")
+}
+
+func newTransport(network, address string) (transport, error) {
+	switch network {
+	case "udp", "unixgram":
+		t := &packetTransport{redialer{network: network, address: address}}
+		// unlike a relay, a local agent has to be there at startup
+		if err := t.connect(time.Now()); err != nil {
+			return nil, err
+		}
+		return t, nil
+	case "tcp", "unix":
+		t := &streamTransport{redialer: redialer{network: network, address: address}}
+		// a relay that is down at startup is not fatal, Write keeps retrying
+		t.mu.Lock()
+		t.connect(time.Now())
+		t.mu.Unlock()
+		return t, nil
+	}
+	return nil, errors.New("unsupported statsd transport \"" + network + "\"")
+}
+
+// a connection that is dialed again, with exponential backoff, whenever a
+// write on it fails
+type redialer struct {
+	network string
+	address string
+	mu      sync.Mutex
+	conn    net.Conn
+	delay   time.Duration
+	retryAt time.Time
+	closed  bool
+}
+
+// callers must hold t.mu
+func (t *redialer) connect(now time.Time) error {
+	if now.Before(t.retryAt) {
+		return errReconnectPending
+	}
+	conn, err := net.DialTimeout(t.network, t.address, dialTimeout)
+	if err != nil {
+		t.backOff(now)
+		return err
+	}
+	t.conn = conn
+	t.delay = 0
+	return nil
+}
+
+// callers must hold t.mu
+func (t *redialer) backOff(now time.Time) {
+	t.delay *= 2
+	if t.delay == 0 {
+		t.delay = minReconnectDelay
+	} else if t.delay > maxReconnectDelay {
+		t.delay = maxReconnectDelay
+	}
+	t.retryAt = now.Add(t.delay)
+}
+
+// callers must hold t.mu
+func (t *redialer) write(payload []byte) error {
+	if t.closed {
+		return errors.New("statsd connection is closed")
+	}
+	now := time.Now()
+	if t.conn == nil {
+		if err := t.connect(now); err != nil {
+			return err
+		}
+	}
+	t.conn.SetWriteDeadline(now.Add(writeTimeout))
+	if _, err := t.conn.Write(payload); err != nil {
+		t.conn.Close()
+		t.conn = nil
+		// the next write reconnects straight away, repeated failures back off
+		t.retryAt = now
+		return err
+	}
+	return nil
+}
+
+func (t *redialer) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.closed = true
+	if t.conn == nil {
+		return nil
+	}
+	err := t.conn.Close()
+	t.conn = nil
+	return err
+}
+
+// sends every line as its own datagram. A restarted agent, e.g. a unixgram
+// socket that was removed and created again, is dialed again.
+type packetTransport struct {
+	redialer
+}
+
+func (t *packetTransport) Write(line []byte) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.write(line)
+}
+
+// sends newline framed lines over a connection that is re-established with
+// exponential backoff whenever it breaks
+type streamTransport struct {
+	redialer
+	buf []byte
+}
+
+func (t *streamTransport) Write(line []byte) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.buf = append(append(t.buf[:0], line...), '\n')
+	return t.write(t.buf)
+}
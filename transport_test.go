@@ -0,0 +1,220 @@
+package gstats
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/franela/goblin"
+	. "github.com/onsi/gomega"
+)
+
+func helper_ReadLine(lines chan string) string {
+	select {
+	case line := <-lines:
+		return line
+	case <-time.After(time.Second):
+		return ""
+	}
+}
+
+// accepts stream connections and pushes every line it reads onto lines
+func helper_ServeLines(listener net.Listener, lines chan string) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			scanner := bufio.NewScanner(conn)
+			for scanner.Scan() {
+				lines <- scanner.Text()
+			}
+		}()
+	}
+}
+
+func TestTransports(t *testing.T) {
+	g := Goblin(t)
+	RegisterFailHandler(func(m string, _ ...int) { g.Fail(m) })
+	g.Describe("Address parsing", func() {
+		g.It("should treat a bare host:port as udp", func() {
+			network, address, err := parseAddress("127.0.0.1:8125")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(network).To(Equal("udp"))
+			Expect(address).To(Equal("127.0.0.1:8125"))
+		})
+		g.It("should understand every supported scheme", func() {
+			network, address, err := parseAddress("tcp://relay.example.com:8125")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(network).To(Equal("tcp"))
+			Expect(address).To(Equal("relay.example.com:8125"))
+
+			network, address, err = parseAddress("udp://127.0.0.1:8125")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(network).To(Equal("udp"))
+			Expect(address).To(Equal("127.0.0.1:8125"))
+
+			network, address, err = parseAddress("unix:///var/run/statsd.sock")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(network).To(Equal("unix"))
+			Expect(address).To(Equal("/var/run/statsd.sock"))
+
+			network, address, err = parseAddress("unixgram:///var/run/statsd.sock")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(network).To(Equal("unixgram"))
+			Expect(address).To(Equal("/var/run/statsd.sock"))
+		})
+		g.It("should reject unknown schemes and empty addresses", func() {
+			_, _, err := parseAddress("http://127.0.0.1:8125")
+			Expect(err).To(HaveOccurred())
+			_, _, err = parseAddress("tcp://")
+			Expect(err).To(HaveOccurred())
+			_, _, err = parseAddress("unix://")
+			Expect(err).To(HaveOccurred())
+		})
+		g.It("should fail to create a client for an unknown scheme", func() {
+			os.Setenv("STATSD_ADDRESS", "http://127.0.0.1:8125")
+			os.Setenv("STATSD_PREFIX", "test")
+			_, err := CreateStatsdClient()
+			Expect(err).To(HaveOccurred())
+		})
+	})
+	g.Describe("tcp transport", func() {
+		var listener net.Listener
+		var lines chan string
+		g.BeforeEach(func() {
+			var err error
+			listener, err = net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).NotTo(HaveOccurred())
+			lines = make(chan string, 100)
+			go helper_ServeLines(listener, lines)
+			os.Setenv("STATSD_ADDRESS", "tcp://"+listener.Addr().String())
+			os.Setenv("STATSD_PREFIX", "test")
+		})
+		g.AfterEach(func() {
+			listener.Close()
+		})
+		g.It("should send newline framed stats", func() {
+			stats, err := CreateStatsdClient()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stats.Inc("teststat")).NotTo(HaveOccurred())
+			Expect(stats.Gauge("testgauge", 5)).NotTo(HaveOccurred())
+			Expect(helper_ReadLine(lines)).To(Equal("test.teststat.count:1|c"))
+			Expect(helper_ReadLine(lines)).To(Equal("test.testgauge:5|g"))
+		})
+		g.It("should reconnect after the connection is lost", func() {
+			stats, err := CreateStatsdClient()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stats.Inc("teststat")).NotTo(HaveOccurred())
+			Expect(helper_ReadLine(lines)).To(Equal("test.teststat.count:1|c"))
+
+			address := listener.Addr().String()
+			listener.Close()
+			stream := stats.filter.next.(*statsdClient).transport.(*streamTransport)
+			stream.mu.Lock()
+			stream.conn.Close()
+			stream.mu.Unlock()
+			listener, err = net.Listen("tcp", address)
+			Expect(err).NotTo(HaveOccurred())
+			go helper_ServeLines(listener, lines)
+
+			deadline := time.Now().Add(2 * time.Second)
+			for time.Now().Before(deadline) {
+				stats.Inc("reconnected")
+				select {
+				case line := <-lines:
+					Expect(line).To(Equal("test.reconnected.count:1|c"))
+					return
+				case <-time.After(10 * time.Millisecond):
+				}
+			}
+			g.Fail("never reconnected")
+		})
+		g.It("should back off while the server is unreachable", func() {
+			address := listener.Addr().String()
+			listener.Close()
+			transport, err := newTransport("tcp", address)
+			Expect(err).NotTo(HaveOccurred())
+			stream := transport.(*streamTransport)
+			Expect(stream.conn).To(BeNil())
+			Expect(stream.delay).To(Equal(minReconnectDelay))
+			Expect(transport.Write([]byte("test.x:1|c"))).To(Equal(errReconnectPending))
+		})
+	})
+	g.Describe("unix transports", func() {
+		var dir string
+		g.BeforeEach(func() {
+			var err error
+			dir, err = os.MkdirTemp("", "gstats")
+			Expect(err).NotTo(HaveOccurred())
+			os.Setenv("STATSD_PREFIX", "test")
+		})
+		g.AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+		g.It("should send newline framed stats over a unix stream socket", func() {
+			path := filepath.Join(dir, "statsd.sock")
+			listener, err := net.Listen("unix", path)
+			Expect(err).NotTo(HaveOccurred())
+			defer listener.Close()
+			lines := make(chan string, 10)
+			go helper_ServeLines(listener, lines)
+
+			os.Setenv("STATSD_ADDRESS", "unix://"+path)
+			stats, err := CreateStatsdClient()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stats.IncrementBy("teststat", 3)).NotTo(HaveOccurred())
+			Expect(helper_ReadLine(lines)).To(Equal("test.teststat:3|c"))
+		})
+		g.It("should send datagrams over a unixgram socket", func() {
+			path := filepath.Join(dir, "statsd.sock")
+			sock, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+			Expect(err).NotTo(HaveOccurred())
+			defer sock.Close()
+
+			os.Setenv("STATSD_ADDRESS", "unixgram://"+path)
+			stats, err := CreateStatsdClient()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stats.Inc("teststat")).NotTo(HaveOccurred())
+			buf := make([]byte, 1024)
+			sock.SetReadDeadline(time.Now().Add(time.Second))
+			readLength, err := sock.Read(buf)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(buf[:readLength])).To(Equal("test.teststat.count:1|c"))
+		})
+		g.It("should redial a unixgram socket that was removed and created again", func() {
+			path := filepath.Join(dir, "statsd.sock")
+			sock, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+			Expect(err).NotTo(HaveOccurred())
+			transport, err := newTransport("unixgram", path)
+			Expect(err).NotTo(HaveOccurred())
+			defer transport.Close()
+			Expect(transport.Write([]byte("test.before:1|c"))).NotTo(HaveOccurred())
+
+			// the agent restarts
+			sock.Close()
+			os.Remove(path)
+			Expect(transport.Write([]byte("test.down:1|c"))).To(HaveOccurred())
+			sock, err = net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+			Expect(err).NotTo(HaveOccurred())
+			defer sock.Close()
+
+			buf := make([]byte, 1024)
+			deadline := time.Now().Add(2 * time.Second)
+			for time.Now().Before(deadline) {
+				transport.Write([]byte("test.after:1|c"))
+				sock.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+				if readLength, err := sock.Read(buf); err == nil {
+					Expect(string(buf[:readLength])).To(Equal("test.after:1|c"))
+					return
+				}
+			}
+			g.Fail("never redialed")
+		})
+	})
+}